@@ -0,0 +1,536 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Actions for Shortcuts, Activators and Macros are written in a small scripting language, one
+// statement per line. Scripts are parsed when the configuration is loaded so that mistakes are
+// reported then rather than when a button is pressed.
+
+type script struct {
+	stmts []actionStmt
+	async bool
+}
+
+type actionStmt interface {
+	exec(env *actionEnv)
+}
+
+type commandStmt struct {
+	text string
+}
+
+type setStmt struct {
+	name  string
+	value string
+}
+
+type waitStmt struct {
+	d time.Duration
+}
+
+type ifStmt struct {
+	cond      condExpr
+	then      []actionStmt
+	otherwise []actionStmt
+}
+
+type toggleStmt struct {
+	lock   sync.Mutex
+	on     bool
+	first  []actionStmt
+	second []actionStmt
+}
+
+type repeatStmt struct {
+	count int
+	body  []actionStmt
+}
+
+type parallelStmt struct {
+	branches [][]actionStmt
+}
+
+type whenStmt struct {
+	conds     []condExpr
+	bodies    [][]actionStmt
+	otherwise []actionStmt
+}
+
+// actionEnv is everything a running script needs to act on vMix and the APC
+type actionEnv struct {
+	client      *vmixClient
+	conf        config
+	vmixState   *state
+	midiOutChan chan apcLEDS
+	verseChan   chan verses
+	button      int
+	args        map[string]string
+	ledsOnly    bool
+}
+
+// scriptVars holds the variables set by scripts. They are shared by all buttons so one
+// button can set a value that another one uses.
+var scriptVars = struct {
+	lock sync.RWMutex
+	vars map[string]string
+}{vars: make(map[string]string)}
+
+var varPattern = regexp.MustCompile(`\$[A-Za-z_][A-Za-z0-9_]*`)
+var varName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func newActionEnv(client *vmixClient, conf config, vmixState *state, midiOutChan chan apcLEDS,
+	verseChan chan verses, button int) *actionEnv {
+	return &actionEnv{
+		client:      client,
+		conf:        conf,
+		vmixState:   vmixState,
+		midiOutChan: midiOutChan,
+		verseChan:   verseChan,
+		button:      button,
+		args:        make(map[string]string),
+	}
+}
+
+// runScript runs a script. Scripts that wait run in the background so that the APC stays
+// responsive.
+func runScript(s *script, env *actionEnv) {
+	if s == nil {
+		return
+	}
+	if s.async {
+		go execBlock(s.stmts, env)
+	} else {
+		execBlock(s.stmts, env)
+	}
+}
+
+// brokenShortcut reports a shortcut whose actions could not be parsed instead of ignoring the press
+func brokenShortcut(sc *shortcut, midiOutChan chan apcLEDS) bool {
+	if sc.err == nil {
+		return false
+	}
+	fmt.Println("Error in Shortcuts, button", strconv.Itoa(sc.button)+":", sc.err)
+	midiOutChan <- apcLEDS{
+		buttons: []int{sc.button},
+		color:   "redBlink",
+	}
+	return true
+}
+
+func execBlock(stmts []actionStmt, env *actionEnv) {
+	for _, stmt := range stmts {
+		stmt.exec(env)
+	}
+}
+
+func (s *commandStmt) exec(env *actionEnv) {
+	execCommand(env, expandVars(env, s.text))
+}
+
+func (s *setStmt) exec(env *actionEnv) {
+	scriptVars.lock.Lock()
+	scriptVars.vars[s.name] = expandVars(env, s.value)
+	scriptVars.lock.Unlock()
+}
+
+func (s *waitStmt) exec(env *actionEnv) {
+	time.Sleep(s.d)
+}
+
+func (s *ifStmt) exec(env *actionEnv) {
+	if s.cond.eval(env) {
+		execBlock(s.then, env)
+	} else {
+		execBlock(s.otherwise, env)
+	}
+}
+
+func (s *toggleStmt) exec(env *actionEnv) {
+	s.lock.Lock()
+	s.on = !s.on
+	on := s.on
+	s.lock.Unlock()
+
+	if on {
+		execBlock(s.first, env)
+	} else {
+		execBlock(s.second, env)
+	}
+}
+
+func (s *repeatStmt) exec(env *actionEnv) {
+	for i := 0; i < s.count; i++ {
+		execBlock(s.body, env)
+	}
+}
+
+func (s *whenStmt) exec(env *actionEnv) {
+	for i, cond := range s.conds {
+		if cond.eval(env) {
+			execBlock(s.bodies[i], env)
+			return
+		}
+	}
+	execBlock(s.otherwise, env)
+}
+
+func (s *parallelStmt) exec(env *actionEnv) {
+	var wg sync.WaitGroup
+	for _, branch := range s.branches {
+		wg.Add(1)
+		go func(branch []actionStmt) {
+			defer wg.Done()
+			execBlock(branch, env)
+		}(branch)
+	}
+	wg.Wait()
+}
+
+// lookupVar returns the value of a variable. Arguments of the running script take precedence
+// over the shared variables.
+func lookupVar(env *actionEnv, name string) string {
+	if value, ok := env.args[name]; ok {
+		return value
+	}
+	scriptVars.lock.RLock()
+	defer scriptVars.lock.RUnlock()
+	value, ok := scriptVars.vars[name]
+	if !ok {
+		debug("Variable is not set:", name)
+	}
+	return value
+}
+
+// expandVars replaces $name with the value of the variable
+func expandVars(env *actionEnv, text string) string {
+	if !strings.Contains(text, "$") {
+		return text
+	}
+	return varPattern.ReplaceAllStringFunc(text, func(v string) string {
+		return lookupVar(env, v[1:])
+	})
+}
+
+// parseScript parses the content of an actions cell. An empty cell gives a nil script.
+func parseScript(source string) (*script, error) {
+	p := &scriptParser{lines: strings.Split(source, "\n")}
+	stmts, end, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+	if end != "" {
+		return nil, fmt.Errorf("line %d: %q without a matching block", p.pos, end)
+	}
+	if len(stmts) == 0 {
+		return nil, nil
+	}
+	return &script{stmts: stmts, async: p.async}, nil
+}
+
+type scriptParser struct {
+	lines    []string
+	pos      int
+	async    bool
+	stopRest string
+}
+
+// parseBlock parses statements until the end of the script or a line that closes the block
+// (else, and, end, or one of the extra stop keywords). It returns the closing keyword.
+func (p *scriptParser) parseBlock(stops ...string) ([]actionStmt, string, error) {
+	var stmts []actionStmt
+	for p.pos < len(p.lines) {
+		line := strings.TrimSpace(p.lines[p.pos])
+		p.pos++
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		keyword, rest := splitKeyword(line)
+		switch keyword {
+		case "else", "and", "end", "otherwise":
+			if rest != "" {
+				return nil, "", p.errorf("unexpected %q after %s", rest, keyword)
+			}
+			if keyword == "otherwise" && !containsKeyword(stops, keyword) {
+				return nil, "", p.errorf("otherwise without when")
+			}
+			return stmts, keyword, nil
+		case "when":
+			if containsKeyword(stops, keyword) {
+				p.stopRest = rest
+				return stmts, keyword, nil
+			}
+			stmt, end, err := p.parseWhen(rest)
+			if err != nil {
+				return nil, "", err
+			}
+			stmts = append(stmts, stmt)
+			if end != "" {
+				return stmts, end, nil
+			}
+			continue
+		}
+
+		stmt, err := p.parseStmt(keyword, rest, line)
+		if err != nil {
+			return nil, "", err
+		}
+		stmts = append(stmts, stmt)
+	}
+	return stmts, "", nil
+}
+
+// parseWhen parses a chain of when sections. The chain ends where the enclosing block ends,
+// so the closing keyword of that block is returned to the caller.
+func (p *scriptParser) parseWhen(condText string) (actionStmt, string, error) {
+	stmt := new(whenStmt)
+	for {
+		cond, err := parseCondition(condText)
+		if err != nil {
+			return nil, "", p.errorf("%v", err)
+		}
+		body, end, err := p.parseBlock("when", "otherwise")
+		if err != nil {
+			return nil, "", err
+		}
+		stmt.conds = append(stmt.conds, cond)
+		stmt.bodies = append(stmt.bodies, body)
+
+		switch end {
+		case "when":
+			condText = p.stopRest
+		case "otherwise":
+			stmt.otherwise, end, err = p.parseBlock()
+			return stmt, end, err
+		default:
+			return stmt, end, nil
+		}
+	}
+}
+
+func containsKeyword(keywords []string, keyword string) bool {
+	for _, k := range keywords {
+		if k == keyword {
+			return true
+		}
+	}
+	return false
+}
+
+// walkScript calls fn for every statement of a script, including the statements nested in
+// blocks. It stops at the first error.
+func walkScript(stmts []actionStmt, fn func(actionStmt) error) error {
+	for _, stmt := range stmts {
+		if err := fn(stmt); err != nil {
+			return err
+		}
+		var blocks [][]actionStmt
+		switch s := stmt.(type) {
+		case *ifStmt:
+			blocks = [][]actionStmt{s.then, s.otherwise}
+		case *toggleStmt:
+			blocks = [][]actionStmt{s.first, s.second}
+		case *repeatStmt:
+			blocks = [][]actionStmt{s.body}
+		case *parallelStmt:
+			blocks = s.branches
+		case *whenStmt:
+			blocks = append(append(blocks, s.bodies...), s.otherwise)
+		}
+		for _, block := range blocks {
+			if err := walkScript(block, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *scriptParser) parseStmt(keyword, rest, line string) (actionStmt, error) {
+	switch keyword {
+	case "set":
+		parts := strings.SplitN(rest, "=", 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || !varName.MatchString(name) {
+			return nil, p.errorf("expected 'set name = value'")
+		}
+		return &setStmt{name: name, value: strings.TrimSpace(parts[1])}, nil
+
+	case "wait":
+		d, err := parseWait(rest)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		p.async = true
+		return &waitStmt{d: d}, nil
+
+	case "if":
+		return p.parseIf(rest)
+
+	case "toggle":
+		if rest != "" {
+			return nil, p.errorf("toggle takes no arguments")
+		}
+		first, end, err := p.parseBlock()
+		if err != nil {
+			return nil, err
+		}
+		stmt := &toggleStmt{first: first}
+		if end == "else" {
+			stmt.second, end, err = p.parseBlock()
+			if err != nil {
+				return nil, err
+			}
+		}
+		if end != "end" {
+			return nil, p.errorf("toggle without end")
+		}
+		return stmt, nil
+
+	case "repeat":
+		count, err := strconv.Atoi(rest)
+		if err != nil || count < 1 {
+			return nil, p.errorf("expected 'repeat count'")
+		}
+		body, end, err := p.parseBlock()
+		if err != nil {
+			return nil, err
+		}
+		if end != "end" {
+			return nil, p.errorf("repeat without end")
+		}
+		return &repeatStmt{count: count, body: body}, nil
+
+	case "parallel":
+		if rest != "" {
+			return nil, p.errorf("parallel takes no arguments")
+		}
+		stmt := new(parallelStmt)
+		for {
+			branch, end, err := p.parseBlock()
+			if err != nil {
+				return nil, err
+			}
+			stmt.branches = append(stmt.branches, branch)
+			if end == "end" {
+				break
+			}
+			if end != "and" {
+				return nil, p.errorf("parallel without end")
+			}
+		}
+		p.async = true
+		return stmt, nil
+	}
+
+	if err := checkCommand(line); err != nil {
+		return nil, p.errorf("%v", err)
+	}
+	return &commandStmt{text: line}, nil
+}
+
+// parseIf parses both the block form and the single line form of if
+func (p *scriptParser) parseIf(rest string) (actionStmt, error) {
+	condText, body := splitOn(rest, "then")
+	if body == "" && !strings.HasSuffix(rest, "then") {
+		return nil, p.errorf("expected 'if condition then'")
+	}
+	cond, err := parseCondition(condText)
+	if err != nil {
+		return nil, p.errorf("%v", err)
+	}
+	stmt := &ifStmt{cond: cond}
+
+	if body != "" {
+		thenText, elseText := splitOn(body, "else")
+		if thenText == "" {
+			return nil, p.errorf("expected a command after then")
+		}
+		hasElse := thenText != strings.TrimSpace(body)
+		if hasElse && elseText == "" {
+			return nil, p.errorf("expected a command after else")
+		}
+		for _, text := range []string{thenText, elseText} {
+			if text == "" {
+				continue
+			}
+			if err := checkCommand(text); err != nil {
+				return nil, p.errorf("%v", err)
+			}
+		}
+		stmt.then = []actionStmt{&commandStmt{text: thenText}}
+		if elseText != "" {
+			stmt.otherwise = []actionStmt{&commandStmt{text: elseText}}
+		}
+		return stmt, nil
+	}
+
+	var end string
+	stmt.then, end, err = p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+	if end == "else" {
+		stmt.otherwise, end, err = p.parseBlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if end != "end" {
+		return nil, p.errorf("if without end")
+	}
+	return stmt, nil
+}
+
+func (p *scriptParser) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("line %d: %s", p.pos, fmt.Sprintf(format, a...))
+}
+
+// splitKeyword returns the first word of a line and the rest of the line
+func splitKeyword(line string) (string, string) {
+	parts := strings.SplitN(line, " ", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], strings.TrimSpace(parts[1])
+}
+
+// splitOn splits text around the first occurrence of a keyword that is not inside quotes
+func splitOn(text, keyword string) (string, string) {
+	inQuotes := false
+	for i := 0; i < len(text); i++ {
+		if text[i] == '"' {
+			inQuotes = !inQuotes
+			continue
+		}
+		if inQuotes || !strings.HasPrefix(text[i:], keyword) {
+			continue
+		}
+		before := i == 0 || text[i-1] == ' '
+		after := i+len(keyword) == len(text) || text[i+len(keyword)] == ' '
+		if before && after {
+			return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+len(keyword):])
+		}
+	}
+	return strings.TrimSpace(text), ""
+}
+
+// parseWait parses the duration of a wait: 500ms, 2s, 1m30s or a plain number of milliseconds
+func parseWait(text string) (time.Duration, error) {
+	if ms, err := strconv.Atoi(text); err == nil && ms >= 0 {
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+	d, err := time.ParseDuration(text)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("expected 'wait duration', ex: wait 500ms")
+	}
+	return d, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// describe writes the statements of a script in a compact form that tests can compare
+func describe(stmts []actionStmt) string {
+	var parts []string
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *commandStmt:
+			parts = append(parts, s.text)
+		case *setStmt:
+			parts = append(parts, "set "+s.name+"="+s.value)
+		case *waitStmt:
+			parts = append(parts, "wait "+s.d.String())
+		case *ifStmt:
+			parts = append(parts, "if("+describe(s.then)+"|"+describe(s.otherwise)+")")
+		case *toggleStmt:
+			parts = append(parts, "toggle("+describe(s.first)+"|"+describe(s.second)+")")
+		case *repeatStmt:
+			parts = append(parts, "repeat "+strconv.Itoa(s.count)+"("+describe(s.body)+")")
+		case *parallelStmt:
+			var branches []string
+			for _, branch := range s.branches {
+				branches = append(branches, describe(branch))
+			}
+			parts = append(parts, "parallel("+strings.Join(branches, "|")+")")
+		case *whenStmt:
+			var bodies []string
+			for _, body := range s.bodies {
+				bodies = append(bodies, describe(body))
+			}
+			parts = append(parts, "when("+strings.Join(bodies, "|")+"|"+describe(s.otherwise)+")")
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+func TestParseScript(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+		async  bool
+	}{
+		{"empty", "", "", false},
+		{"comments", "# nothing\n\n", "", false},
+		{"command", "Cut", "Cut", false},
+		{"variables", "set cam = Left\nPreviewInput Input=$cam", "set cam=Left; PreviewInput Input=$cam", false},
+		{"wait milliseconds", "wait 500", "wait 500ms", true},
+		{"wait duration", "wait 1m30s", "wait 1m30s", true},
+		{"inline if", "if Streaming=1 then StopStreaming", "if(StopStreaming|)", false},
+		{"inline if else", "if Streaming=1 then StopStreaming else StartStreaming", "if(StopStreaming|StartStreaming)", false},
+		{"inline if quoted else", `if Input="Or else" then Cut`, "if(Cut|)", false},
+		{"block if", "if Streaming=1 then\n  Cut\n  Fade\nend", "if(Cut; Fade|)", false},
+		{"block if else", "if Streaming=1 then\nCut\nelse\nFade\nend", "if(Cut|Fade)", false},
+		{"toggle", "toggle\nOverlayInput1In\nelse\nOverlayInput1Out\nend", "toggle(OverlayInput1In|OverlayInput1Out)", false},
+		{"toggle without else", "toggle\nCut\nend", "toggle(Cut|)", false},
+		{"repeat", "repeat 3\nCut\nwait 1s\nend", "repeat 3(Cut; wait 1s)", true},
+		{"parallel", "parallel\nCut\nand\nwait 2s\nFade\nend", "parallel(Cut|wait 2s; Fade)", true},
+		{"when", "when Streaming=1\nCut\nwhen Input=2\nFade\notherwise\nStinger1", "when(Cut|Fade|Stinger1)", false},
+		{"nested", "repeat 2\nif Streaming=1 then\ntoggle\nCut\nend\nend\nend", "repeat 2(if(toggle(Cut|)|))", false},
+	}
+	for _, tt := range tests {
+		s, err := parseScript(tt.source)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if tt.want == "" {
+			if s != nil {
+				t.Errorf("%s: got %q, want no script", tt.name, describe(s.stmts))
+			}
+			continue
+		}
+		if s == nil {
+			t.Errorf("%s: got no script, want %q", tt.name, tt.want)
+			continue
+		}
+		if got := describe(s.stmts); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+		if s.async != tt.async {
+			t.Errorf("%s: async is %v, want %v", tt.name, s.async, tt.async)
+		}
+	}
+}
+
+func TestParseScriptErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"set without value", "set cam", "line 1: expected 'set name = value'"},
+		{"set bad name", "set 1cam = Left", "line 1: expected 'set name = value'"},
+		{"wait without unit", "wait soon", "line 1: expected 'wait duration'"},
+		{"negative wait", "wait -1s", "line 1: expected 'wait duration'"},
+		{"if without then", "if Streaming=1 Cut", "line 1: expected 'if condition then'"},
+		{"if without condition", "if then Cut", "line 1: missing condition"},
+		{"empty then", "if Streaming=1 then else Cut", "line 1: expected a command after then"},
+		{"empty else", "if Streaming=1 then Cut else", "line 1: expected a command after else"},
+		{"if without end", "if Streaming=1 then\nCut", "line 2: if without end"},
+		{"toggle with arguments", "toggle 2", "line 1: toggle takes no arguments"},
+		{"toggle without end", "toggle\nCut", "line 2: toggle without end"},
+		{"repeat without count", "repeat\nCut\nend", "line 1: expected 'repeat count'"},
+		{"repeat zero", "repeat 0\nCut\nend", "line 1: expected 'repeat count'"},
+		{"repeat without end", "repeat 2\nCut", "line 2: repeat without end"},
+		{"parallel without end", "parallel\nCut\nand\nFade", "line 4: parallel without end"},
+		{"end without block", "Cut\nend", "line 2: \"end\" without a matching block"},
+		{"else with text", "toggle\nCut\nelse Fade\nend", "line 3: unexpected \"Fade\" after else"},
+		{"otherwise without when", "otherwise", "line 1: otherwise without when"},
+		{"bad command", "leds green", "line 1: expected 'leds color buttons'"},
+		{"bad inline command", "if Streaming=1 then stage maybe", "line 1: expected 'stage on'"},
+	}
+	for _, tt := range tests {
+		_, err := parseScript(tt.source)
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestParseWait(t *testing.T) {
+	tests := map[string]time.Duration{
+		"0":     0,
+		"250":   250 * time.Millisecond,
+		"2s":    2 * time.Second,
+		"500ms": 500 * time.Millisecond,
+	}
+	for text, want := range tests {
+		got, err := parseWait(text)
+		if err != nil || got != want {
+			t.Errorf("parseWait(%q) = %v, %v, want %v", text, got, err, want)
+		}
+	}
+}
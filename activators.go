@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// inputRule selects the inputs an activator applies to: one input, a range, a name pattern, any
+// input or the inputs no other activator matched
+type inputRule struct {
+	kind     string
+	input    string
+	from, to int
+}
+
+var inputRange = regexp.MustCompile(`^(\d+)\s*-\s*(\d+)$`)
+
+func parseInputRule(text string) (inputRule, error) {
+	text = strings.TrimSpace(text)
+	switch {
+	case text == "":
+		return inputRule{}, fmt.Errorf("missing input")
+	case text == "*":
+		return inputRule{kind: "any"}, nil
+	case strings.EqualFold(text, "other"):
+		return inputRule{kind: "other"}, nil
+	case inputRange.MatchString(text):
+		m := inputRange.FindStringSubmatch(text)
+		from, _ := strconv.Atoi(m[1])
+		to, _ := strconv.Atoi(m[2])
+		if from > to {
+			return inputRule{}, fmt.Errorf("invalid input range %q", text)
+		}
+		return inputRule{kind: "range", from: from, to: to}, nil
+	case strings.ContainsAny(text, "*?"):
+		pattern := strings.ToLower(text)
+		if _, err := path.Match(pattern, ""); err != nil {
+			return inputRule{}, fmt.Errorf("invalid input pattern %q", text)
+		}
+		return inputRule{kind: "pattern", input: pattern}, nil
+	}
+	return inputRule{kind: "input", input: text}, nil
+}
+
+// matches reports whether the rule applies to an input of an activator message. The input is
+// the number sent by vMix, or "none".
+func (r inputRule) matches(vmixState *state, input string) bool {
+	name := inputName(vmixState, input)
+
+	switch r.kind {
+	case "input":
+		return r.input == input || (name != "" && strings.EqualFold(r.input, name))
+	case "any":
+		return input != "none"
+	case "range":
+		number, err := strconv.Atoi(input)
+		return err == nil && number >= r.from && number <= r.to
+	case "pattern":
+		ok, _ := path.Match(r.input, strings.ToLower(name))
+		return ok
+	}
+	return false
+}
+
+// matchActivators returns the activators of a trigger that apply to an input. All the
+// matching activators are returned in the order of the sheet; the "other" activators only
+// when nothing else matched.
+func matchActivators(conf config, vmixState *state, trigger string, input string) []*activator {
+	var matched []*activator
+	var fallback []*activator
+	for _, act := range conf.activator[trigger] {
+		if act.rule.kind == "other" {
+			fallback = append(fallback, act)
+		} else if act.rule.matches(vmixState, input) {
+			matched = append(matched, act)
+		}
+	}
+	if len(matched) == 0 && input != "none" {
+		return fallback
+	}
+	return matched
+}
+
+// activatorGuard is how long after its script has finished an activator ignores the same
+// trigger, so a waiting script that causes its own trigger (ex: CutDirect on an Input activator)
+// doesn't run in a loop
+const activatorGuard = 500 * time.Millisecond
+
+type activatorRun struct {
+	act   *activator
+	input string
+	state string
+}
+
+// activatorRuns holds the activator scripts that are running (zero time) or when they finished
+var activatorRuns = struct {
+	lock sync.Mutex
+	runs map[activatorRun]time.Time
+}{runs: make(map[activatorRun]time.Time)}
+
+// startActivator returns false when the script of an activator for an input and state is
+// running or has just finished
+func startActivator(act *activator, input, state string) bool {
+	activatorRuns.lock.Lock()
+	defer activatorRuns.lock.Unlock()
+	run := activatorRun{act: act, input: input, state: state}
+	if finished, ok := activatorRuns.runs[run]; ok && (finished.IsZero() || time.Since(finished) < activatorGuard) {
+		return false
+	}
+	activatorRuns.runs[run] = time.Time{}
+	return true
+}
+
+func finishActivator(act *activator, input, state string) {
+	activatorRuns.lock.Lock()
+	defer activatorRuns.lock.Unlock()
+	activatorRuns.runs[activatorRun{act: act, input: input, state: state}] = time.Now()
+}
+
+// resolveInput returns the name of an input given by number or by name
+func resolveInput(vmixState *state, input string) string {
+	if name := inputName(vmixState, input); name != "" {
+		return name
+	}
+	return input
+}
+
+// inputName returns the name of an input from its number
+func inputName(vmixState *state, input string) string {
+	vmixState.lock.RLock()
+	defer vmixState.lock.RUnlock()
+	return vmixState.numberToName[input]
+}
+
+// refreshInputs keeps the input names and title fields of the vMix state current, every "Input
+// Refresh" seconds (Settings sheet). This is a blocking function.
+func refreshInputs(vc vcConfig, conf config, vmixState *state) {
+	interval := 10 * time.Second
+	if s, err := strconv.Atoi(conf.misc["Input Refresh"]); err == nil {
+		if s <= 0 {
+			return
+		}
+		interval = time.Duration(s) * time.Second
+	}
+
+	client, err := vmixAPIConnect(vc)
+	if err != nil {
+		return
+	}
+	defer client.conn.Close()
+
+	for range time.Tick(interval) {
+		doc := readVmixXML(client)
+		inputs := doc.FindElements("./vmix/inputs/*")
+		if len(inputs) == 0 {
+			continue
+		}
+
+		nameToNumber := make(map[string]string)
+		numberToName := make(map[string]string)
+		overlayTBNames := make(map[string]string)
+		titleFields := make(map[string][]string)
+		titleImages := make(map[string][]string)
+		for _, input := range inputs {
+			number := input.SelectAttrValue("number", "")
+			name := input.SelectAttrValue("title", "")
+			nameToNumber[name] = number
+			numberToName[number] = name
+			if input.SelectAttrValue("type", "") == "GT" {
+				titleFields[name] = titleNames(input, "text")
+				titleImages[name] = titleNames(input, "image")
+				if len(titleFields[name]) > 0 {
+					overlayTBNames[name] = titleFields[name][0]
+				}
+			}
+		}
+
+		vmixState.lock.Lock()
+		vmixState.nameToNumber = nameToNumber
+		vmixState.numberToName = numberToName
+		vmixState.overlayTBNames = overlayTBNames
+		vmixState.titleFields = titleFields
+		vmixState.titleImages = titleImages
+		vmixState.lock.Unlock()
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// serveAPI starts the HTTP API used to drive vmixAPC from other tools (Companion, scripts, a
+// browser). This is a blocking function.
+func serveAPI(address string, client *vmixClient, conf config, vmixState *state, midiOutChan chan apcLEDS,
+	verseChan chan verses) {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/snapshot/save", func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			http.Error(w, "missing snapshot name", http.StatusBadRequest)
+			return
+		}
+		if err := saveSnapshot(name, conf, vmixState); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, _ = fmt.Fprintln(w, "saved", name)
+	})
+
+	mux.HandleFunc("/snapshot/recall", func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("name")
+		if err := recallSnapshot(name, client, conf, vmixState); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		_, _ = fmt.Fprintln(w, "recalled", name)
+	})
+
+	mux.HandleFunc("/snapshot/list", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintln(w, strings.Join(snapshotNames(), "\n"))
+	})
+
+	mux.HandleFunc("/action", func(w http.ResponseWriter, r *http.Request) {
+		s, err := parseScript(r.URL.Query().Get("do"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if s == nil {
+			http.Error(w, "missing actions", http.StatusBadRequest)
+			return
+		}
+		err = walkScript(s.stmts, func(stmt actionStmt) error {
+			if name, ok := calledMacro(stmt); ok {
+				if _, ok := conf.macro[name]; !ok {
+					return fmt.Errorf("unknown macro %q", name)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		// Don't hold the request while the actions wait
+		go runScript(s, newActionEnv(client, conf, vmixState, midiOutChan, verseChan, 0))
+		_, _ = fmt.Fprintln(w, "ok")
+	})
+
+	debug("HTTP API listening on", address)
+	if err := http.ListenAndServe(address, mux); err != nil {
+		fmt.Println("Unable to start the HTTP API:", err)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"github.com/360EntSecGroup-Skylar/excelize/v2"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// language is where the second language of the verses of a title is shown
+type language struct {
+	textbox string
+	title   string
+	overlay int
+}
+
+var languageSeparator = regexp.MustCompile(`(?m)^[ \t]*//[ \t\r]*$`)
+
+// loadLanguages reads the Second Language sheet
+func loadLanguages(wb *excelize.File, conf config, vmixState *state) {
+	rows, _ := wb.GetRows("Second Language")
+	for idx, row := range rows {
+		if idx == 0 || len(row) < 2 || row[0] == "" {
+			continue
+		}
+		for len(row) < 4 {
+			row = append(row, "")
+		}
+
+		input := resolveInput(vmixState, row[0])
+		lang := &language{textbox: row[1], title: resolveInput(vmixState, row[2]), overlay: 2}
+		if lang.textbox == "" && lang.title != "" {
+			lang.textbox = vmixState.overlayTBNames[lang.title]
+		}
+		if row[3] != "" {
+			var err error
+			lang.overlay, err = strconv.Atoi(row[3])
+			if err != nil || lang.overlay < 2 || lang.overlay > 4 {
+				fmt.Println("Error in Second Language,", row[0]+": Overlay must be 2 to 4")
+				continue
+			}
+		}
+		if lang.textbox == "" {
+			fmt.Println("Error in Second Language,", row[0]+": missing textbox")
+			continue
+		}
+		conf.language[strings.ToLower(input)] = lang
+	}
+}
+
+// splitLanguages splits a verse in its two languages
+func splitLanguages(verse string) (string, string) {
+	parts := languageSeparator.Split(verse, 2)
+	if len(parts) == 1 {
+		return verse, ""
+	}
+	return strings.Trim(parts[0], "\r\n"), strings.Trim(parts[1], "\r\n")
+}
+
+// bilingualPages splits verses in their two languages and into pages that fit the titles. Each
+// verse has as many pages in both languages so they stay in step. second is nil when no verse
+// has a second language.
+func bilingualPages(conf config, input string, verses []string) (first, second []string, err error) {
+	lang, hasLanguage := conf.language[strings.ToLower(input)]
+	secondInput := input
+	if hasLanguage && lang.title != "" {
+		secondInput = lang.title
+	}
+
+	bilingual := false
+	for _, verse := range verses {
+		text, translation := splitLanguages(verse)
+		pages := paginate(conf, input, []string{text})
+		translated := paginate(conf, secondInput, []string{translation})
+		for len(pages) < len(translated) {
+			pages = append(pages, "")
+		}
+		for len(translated) < len(pages) {
+			translated = append(translated, "")
+		}
+		first = append(first, pages...)
+		second = append(second, translated...)
+		bilingual = bilingual || translation != ""
+	}
+
+	switch {
+	case !bilingual:
+		return first, nil, nil
+	case !hasLanguage:
+		return first, nil, fmt.Errorf("%s has no row in the Second Language sheet", input)
+	}
+	return first, second, nil
+}
+
+// addSecondLanguage adds the second language to the textboxes of a title when it goes in the
+// same title. It returns the text for a Second Title otherwise.
+func addSecondLanguage(conf config, input string, texts map[string]string, translation string) string {
+	lang, ok := conf.language[strings.ToLower(input)]
+	if !ok {
+		return ""
+	}
+	if lang.title == "" {
+		texts[lang.textbox] = translation
+		return ""
+	}
+	return translation
+}
+
+// showSecondTitle puts the second language in the Second Title of an input and shows it. A
+// verse without a second language only clears it.
+func showSecondTitle(client *vmixClient, conf config, input string, translation string) {
+	lang, ok := conf.language[strings.ToLower(input)]
+	if !ok || lang.title == "" {
+		return
+	}
+	setTexts(client, lang.title, map[string]string{lang.textbox: translation})
+	if translation == "" {
+		return
+	}
+	_ = SendMessage(client, "FUNCTION OverlayInput"+strconv.Itoa(lang.overlay)+"In Input="+url.QueryEscape(lang.title))
+}
+
+// hideSecondTitle takes the Second Title of an input off the air
+func hideSecondTitle(client *vmixClient, conf config, input string) {
+	lang, ok := conf.language[strings.ToLower(input)]
+	if !ok || lang.title == "" {
+		return
+	}
+	_ = SendMessage(client, "FUNCTION OverlayInput"+strconv.Itoa(lang.overlay)+"Out")
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// checkCommand validates the built-in commands of the action language when the configuration
+// is loaded. Anything that is not a built-in command is sent to vMix as a function.
+func checkCommand(action string) error {
+	if color, buttons, ok := ledEntry(action); ok {
+		return checkLEDs(color, buttons)
+	}
+
+	parts := strings.Fields(action)
+	switch parts[0] {
+	case "leds":
+		// ex: leds green 1,2,3
+		if len(parts) != 3 {
+			return fmt.Errorf("expected 'leds color buttons', ex: leds green 1,2,3")
+		}
+		return checkLEDs(parts[1], parts[2])
+	case "preset":
+		if len(parts) != 3 {
+			return fmt.Errorf("expected 'preset camera_name preset_number'")
+		}
+	case "scene":
+		if len(parts) < 2 {
+			return fmt.Errorf("expected 'scene scene_name'")
+		}
+	case "snapshot":
+		if len(parts) < 3 || (parts[1] != "save" && parts[1] != "recall") {
+			return fmt.Errorf("expected 'snapshot save|recall snapshot_name'")
+		}
+	case "countdown":
+		return checkCountdownCommand(parts[1:])
+	case "cue":
+		if len(parts) < 2 {
+			return fmt.Errorf("expected 'cue go', 'cue back' or 'cue cue_name'")
+		}
+	case "verses":
+		if len(parts) < 2 || len(parts) > 3 || parts[1] != "reset" {
+			return fmt.Errorf("expected 'verses reset' or 'verses reset button'")
+		}
+		if len(parts) == 3 {
+			if _, err := strconv.Atoi(parts[2]); err != nil && !strings.Contains(parts[2], "$") {
+				return fmt.Errorf("invalid button %q", parts[2])
+			}
+		}
+	case "stage":
+		if len(parts) != 2 || (parts[1] != "on" && parts[1] != "off" && parts[1] != "toggle") {
+			return fmt.Errorf("expected 'stage on', 'stage off' or 'stage toggle'")
+		}
+	case "macro":
+		// The macro itself is checked once all macros are loaded
+		if _, _, ok := macroCall(action); !ok || strings.Contains(parts[1], "$") {
+			return fmt.Errorf("expected 'macro macro_name arguments'")
+		}
+	}
+	return nil
+}
+
+// ledEntry recognizes the "color: buttons" form used by Activators, ex: "yellow: 20,21,22"
+func ledEntry(action string) (string, string, bool) {
+	parts := strings.SplitN(action, ": ", 2)
+	if len(parts) != 2 || strings.Contains(parts[0], " ") {
+		return "", "", false
+	}
+	return parts[0], strings.TrimSpace(parts[1]), true
+}
+
+func checkLEDColor(color string) error {
+	if _, ok := ledValues[color]; !ok && color != "off" && !strings.Contains(color, "$") {
+		return fmt.Errorf("unknown LED color %q", color)
+	}
+	return nil
+}
+
+func checkLEDs(color string, buttons string) error {
+	if err := checkLEDColor(color); err != nil {
+		return err
+	}
+	for _, s := range strings.Split(buttons, ",") {
+		if _, err := strconv.Atoi(strings.TrimSpace(s)); err != nil && !strings.Contains(s, "$") {
+			return fmt.Errorf("invalid button %q", s)
+		}
+	}
+	return nil
+}
+
+func setLEDs(env *actionEnv, color string, buttons string) {
+	leds := strings.Split(buttons, ",")
+	iLeds := make([]int, len(leds))
+	for i, s := range leds {
+		iLeds[i], _ = strconv.Atoi(strings.TrimSpace(s))
+	}
+	env.midiOutChan <- apcLEDS{
+		buttons: iLeds,
+		color:   color,
+	}
+}
+
+// isLEDCommand reports whether a command only changes LEDs
+func isLEDCommand(action string) bool {
+	_, _, ok := ledEntry(action)
+	return ok || strings.HasPrefix(action, "leds ")
+}
+
+// execCommand performs a single command of the action language
+func execCommand(env *actionEnv, action string) {
+	if env.ledsOnly && !isLEDCommand(action) && !strings.HasPrefix(action, "macro ") {
+		debug("Skipping action:", action)
+		return
+	}
+	debug("Performing action:", action)
+	conf := env.conf
+	currentButton := env.button
+
+	if color, buttons, ok := ledEntry(action); ok {
+		// ex: yellow: 20,21,22
+		setLEDs(env, color, buttons)
+
+	} else if strings.HasPrefix(action, "leds") {
+		// ex: leds green 1,2,3
+		parts := strings.Split(action, " ")
+		setLEDs(env, parts[1], parts[2])
+
+	} else if strings.HasPrefix(action, "preset") {
+
+		// Move PTZ camera to preset position
+		// syntax: preset camera_name preset_number
+		parts := strings.Split(action, " ")
+		camera := strings.ToLower(parts[1])
+		preset := parts[2]
+		debug("Starting move camera '" + camera + "' to preset: " + preset)
+
+		if cameraConfig, ok := conf.camera[camera]; ok {
+			cameraPreset(cameraConfig, preset)
+		}
+
+	} else if strings.HasPrefix(action, "scene") {
+
+		// Recall a microphone scene
+		// syntax: scene scene_name
+		name := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(action, "scene")))
+		if scene, ok := conf.micScene[name]; ok {
+			recallMicScene(env.client, scene, conf, env.midiOutChan)
+		} else {
+			debug("Unknown mic scene:", name)
+		}
+
+	} else if strings.HasPrefix(action, "snapshot") {
+
+		// Save or recall a named snapshot of the production state
+		// syntax: snapshot save|recall snapshot_name
+		parts := strings.SplitN(action, " ", 3)
+		if len(parts) == 3 && parts[1] == "save" {
+			if err := saveSnapshot(parts[2], conf, env.vmixState); err != nil {
+				fmt.Println("Error saving snapshot:", err)
+			}
+		} else if len(parts) == 3 && parts[1] == "recall" {
+			if err := recallSnapshot(parts[2], env.client, conf, env.vmixState); err != nil {
+				fmt.Println("Error recalling snapshot:", err)
+			}
+		}
+
+	} else if name, args, ok := macroCall(action); ok {
+
+		// Run a macro from the Macros sheet
+		// syntax: macro macro_name arg1 arg2
+		runMacro(env, name, args)
+
+	} else if action == "cancel" || strings.HasPrefix(action, "cancel ") {
+
+		// Cancel the next run of a scheduled action, or of all of them
+		// syntax: cancel [scheduled_action_name]
+		cancelScheduled(conf, strings.TrimSpace(strings.TrimPrefix(action, "cancel")))
+
+	} else if strings.HasPrefix(action, "countdown ") {
+
+		// Control the countdown title
+		// syntax: countdown start [time or duration] | countdown pause | countdown reset
+		countdownCommand(conf, strings.Fields(action)[1:])
+
+	} else if strings.HasPrefix(action, "cue ") {
+
+		// Step through the run of show
+		// syntax: cue go | cue back | cue cue_name
+		cueCommand(env, strings.TrimSpace(strings.TrimPrefix(action, "cue ")))
+
+	} else if strings.HasPrefix(action, "stage ") {
+
+		// Switch stage mode, where verses and titles wait on Preview for take
+		// syntax: stage on | stage off | stage toggle
+		stageCommand(conf, env.midiOutChan, strings.TrimPrefix(action, "stage "))
+
+	} else if action == "take" {
+		takeStaged(env.client, conf, env.midiOutChan)
+
+	} else if strings.HasPrefix(action, "verses ") {
+
+		// Forget the place of the verse sessions
+		// syntax: verses reset [button]
+		versesCommand(strings.Fields(action)[1:])
+
+	} else if action == "Next" {
+		if stepVerses(1, env.verseChan) {
+			env.midiOutChan <- apcLEDS{
+				buttons: []int{currentButton},
+				color:   "yellow",
+			}
+		}
+	} else if action == "Prev" {
+		stepVerses(-1, env.verseChan)
+	} else if action == "OvOff" {
+		item := stopVerses()
+		m := item.overlay.hideFunction()
+		hideSecondTitle(env.client, conf, item.input)
+		clearVerseProgress(conf, env.midiOutChan)
+		hideSpeaker(env.client, conf, env.midiOutChan)
+
+		_ = SendMessage(env.client, m)
+		// Run OverlayOff script
+		_ = SendMessage(env.client, "FUNCTION ScriptStart Value=OverlayOff")
+
+	} else {
+		_ = SendMessage(env.client, "FUNCTION "+action)
+	}
+}
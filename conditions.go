@@ -0,0 +1,344 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// stateFields lists the state fields that can be used in conditions. The value tells whether
+// the field is a per-input map that has to be indexed, ex: state.InputBusBAudio[5]
+var stateFields = map[string]bool{
+	"Input":            false,
+	"InputPreview":     false,
+	"Overlay1":         false,
+	"Overlay2":         false,
+	"Overlay3":         false,
+	"Overlay4":         false,
+	"Overlay5":         false,
+	"Overlay6":         false,
+	"Streaming":        false,
+	"Recording":        false,
+	"InputPlaying":     true,
+	"InputMasterAudio": true,
+	"InputBusAAudio":   true,
+	"InputBusBAudio":   true,
+	"InputBusCAudio":   true,
+	"InputBusDAudio":   true,
+	"InputBusEAudio":   true,
+	"InputBusFAudio":   true,
+	"InputBusGAudio":   true,
+	"InputAudio":       true,
+	"InputLoop":        true,
+	"InputVolume":      true,
+}
+
+type condExpr interface {
+	eval(env *actionEnv) bool
+}
+
+type condOr struct{ left, right condExpr }
+type condAnd struct{ left, right condExpr }
+type condNot struct{ x condExpr }
+type condTruthy struct{ x operand }
+type condCompare struct {
+	left  operand
+	op    string
+	right operand
+}
+
+// operand is a value in a condition: a state field, a variable or a literal
+type operand struct {
+	field   string
+	index   *operand
+	varName string
+	literal string
+}
+
+func (c condOr) eval(env *actionEnv) bool  { return c.left.eval(env) || c.right.eval(env) }
+func (c condAnd) eval(env *actionEnv) bool { return c.left.eval(env) && c.right.eval(env) }
+func (c condNot) eval(env *actionEnv) bool { return !c.x.eval(env) }
+
+func (c condTruthy) eval(env *actionEnv) bool {
+	v := strings.ToLower(c.x.value(env))
+	return v != "" && v != "0" && v != "false"
+}
+
+func (c condCompare) eval(env *actionEnv) bool {
+	left := c.left.value(env)
+	right := c.right.value(env)
+
+	switch c.op {
+	case "==":
+		return equalValues(env.vmixState, left, right)
+	case "!=":
+		return !equalValues(env.vmixState, left, right)
+	}
+
+	l, errL := strconv.ParseFloat(left, 64)
+	r, errR := strconv.ParseFloat(right, 64)
+	if errL != nil || errR != nil {
+		// Not numbers, compare as text
+		l, r = float64(strings.Compare(left, right)), 0
+	}
+	switch c.op {
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	case ">=":
+		return l >= r
+	}
+	return false
+}
+
+// equalValues compares two condition values. Input numbers also match the input's name, so
+// state.Overlay1 == "Hymn" is true when the input titled Hymn is on overlay 1.
+func equalValues(vmixState *state, a, b string) bool {
+	if strings.EqualFold(a, b) {
+		return true
+	}
+	vmixState.lock.RLock()
+	defer vmixState.lock.RUnlock()
+	return strings.EqualFold(vmixState.numberToName[a], b) || strings.EqualFold(a, vmixState.numberToName[b])
+}
+
+func (o operand) value(env *actionEnv) string {
+	switch {
+	case o.field != "":
+		index := ""
+		if o.index != nil {
+			index = o.index.value(env)
+		}
+		return stateValue(env.vmixState, o.field, index)
+	case o.varName != "":
+		return lookupVar(env, o.varName)
+	}
+	return o.literal
+}
+
+// stateValue returns a field of the vMix state as text. Per-input fields are indexed by input
+// number or name.
+func stateValue(vmixState *state, field string, index string) string {
+	input := 0
+	if index != "" {
+		input = inputNumber(vmixState, index)
+	}
+
+	vmixState.lock.RLock()
+	defer vmixState.lock.RUnlock()
+
+	switch field {
+	case "Input":
+		return strconv.Itoa(vmixState.Input)
+	case "InputPreview":
+		return strconv.Itoa(vmixState.InputPreview)
+	case "Overlay1", "Overlay2", "Overlay3", "Overlay4", "Overlay5", "Overlay6":
+		channel, _ := strconv.Atoi(strings.TrimPrefix(field, "Overlay"))
+		return strconv.Itoa(overlayInput(vmixState, channel))
+	case "Streaming":
+		return strconv.Itoa(vmixState.Streaming)
+	case "Recording":
+		return strconv.Itoa(vmixState.Recording)
+	case "InputPlaying":
+		return boolValue(vmixState.InputPlaying[input])
+	case "InputMasterAudio":
+		return boolValue(vmixState.InputMasterAudio[input])
+	case "InputBusAAudio", "InputBusBAudio", "InputBusCAudio", "InputBusDAudio",
+		"InputBusEAudio", "InputBusFAudio", "InputBusGAudio":
+		bus := strings.TrimSuffix(strings.TrimPrefix(field, "InputBus"), "Audio")
+		return boolValue(busAudio(vmixState, bus)[input])
+	case "InputAudio":
+		return boolValue(vmixState.InputAudio[input])
+	case "InputLoop":
+		return boolValue(vmixState.InputLoop[input])
+	case "InputVolume":
+		return strconv.FormatFloat(vmixState.InputVolume[input], 'f', -1, 64)
+	}
+	return ""
+}
+
+func boolValue(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// parseCondition parses a condition such as state.Overlay1 == "Hymn" and not
+// state.InputBusBAudio[Crowd]
+func parseCondition(text string) (condExpr, error) {
+	tokens, err := lexCondition(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("missing condition")
+	}
+	p := &condParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in condition", p.tokens[p.pos])
+	}
+	return expr, nil
+}
+
+// lexCondition splits a condition into tokens. Quoted strings keep their quotes so the parser
+// can tell them apart from words.
+func lexCondition(text string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '"':
+			end := strings.IndexByte(text[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string in condition")
+			}
+			tokens = append(tokens, text[i:i+end+2])
+			i += end + 2
+		case strings.HasPrefix(text[i:], "==") || strings.HasPrefix(text[i:], "!=") ||
+			strings.HasPrefix(text[i:], "<=") || strings.HasPrefix(text[i:], ">="):
+			tokens = append(tokens, text[i:i+2])
+			i += 2
+		case c == '=':
+			tokens = append(tokens, "==")
+			i++
+		case strings.IndexByte("<>()[]", c) >= 0:
+			tokens = append(tokens, string(c))
+			i++
+		default:
+			start := i
+			for i < len(text) && strings.IndexByte(" \t\"=!<>()[]", text[i]) < 0 {
+				i++
+			}
+			if start == i {
+				return nil, fmt.Errorf("unexpected %q in condition", string(c))
+			}
+			tokens = append(tokens, text[start:i])
+		}
+	}
+	return tokens, nil
+}
+
+type condParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *condParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *condParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *condParser) parseOr() (condExpr, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.peek() == "or" {
+		p.next()
+		var right condExpr
+		right, err = p.parseAnd()
+		left = condOr{left, right}
+	}
+	return left, err
+}
+
+func (p *condParser) parseAnd() (condExpr, error) {
+	left, err := p.parseNot()
+	for err == nil && p.peek() == "and" {
+		p.next()
+		var right condExpr
+		right, err = p.parseNot()
+		left = condAnd{left, right}
+	}
+	return left, err
+}
+
+func (p *condParser) parseNot() (condExpr, error) {
+	if p.peek() == "not" {
+		p.next()
+		x, err := p.parseNot()
+		return condNot{x}, err
+	}
+	if p.peek() == "(" {
+		p.next()
+		x, err := p.parseOr()
+		if err == nil && p.next() != ")" {
+			err = fmt.Errorf("missing ) in condition")
+		}
+		return x, err
+	}
+	return p.parseCompare()
+}
+
+func (p *condParser) parseCompare() (condExpr, error) {
+	// A bare state field name is allowed on the left, ex: Streaming=1
+	if _, ok := stateFields[p.peek()]; ok {
+		p.tokens[p.pos] = "state." + p.tokens[p.pos]
+	}
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	switch op := p.peek(); op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		p.next()
+		right, err := p.parseOperand()
+		return condCompare{left, op, right}, err
+	}
+	return condTruthy{left}, nil
+}
+
+func (p *condParser) parseOperand() (operand, error) {
+	t := p.next()
+	switch {
+	case t == "":
+		return operand{}, fmt.Errorf("condition ends unexpectedly")
+	case strings.HasPrefix(t, "\""):
+		return operand{literal: strings.Trim(t, "\"")}, nil
+	case strings.HasPrefix(t, "$"):
+		return operand{varName: t[1:]}, nil
+	case strings.HasPrefix(t, "state."):
+		return p.parseField(strings.TrimPrefix(t, "state."))
+	case strings.IndexByte("()[]<>=!", t[0]) >= 0 || t == "and" || t == "or" || t == "not":
+		return operand{}, fmt.Errorf("unexpected %q in condition", t)
+	}
+	return operand{literal: t}, nil
+}
+
+func (p *condParser) parseField(field string) (operand, error) {
+	indexed, ok := stateFields[field]
+	if !ok {
+		return operand{}, fmt.Errorf("unknown state field %q", field)
+	}
+	o := operand{field: field}
+	if !indexed {
+		return o, nil
+	}
+	if p.next() != "[" {
+		return o, fmt.Errorf("state.%s needs an input, ex: state.%s[1]", field, field)
+	}
+	index, err := p.parseOperand()
+	if err != nil {
+		return o, err
+	}
+	if p.next() != "]" {
+		return o, fmt.Errorf("missing ] after state.%s", field)
+	}
+	o.index = &index
+	return o, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// describeCond writes a parsed condition in a compact form that tests can compare
+func describeCond(expr condExpr) string {
+	switch c := expr.(type) {
+	case condOr:
+		return "(" + describeCond(c.left) + " or " + describeCond(c.right) + ")"
+	case condAnd:
+		return "(" + describeCond(c.left) + " and " + describeCond(c.right) + ")"
+	case condNot:
+		return "not " + describeCond(c.x)
+	case condTruthy:
+		return describeOperand(c.x)
+	case condCompare:
+		return describeOperand(c.left) + " " + c.op + " " + describeOperand(c.right)
+	}
+	return "?"
+}
+
+func describeOperand(o operand) string {
+	switch {
+	case o.field != "":
+		if o.index != nil {
+			return "state." + o.field + "[" + describeOperand(*o.index) + "]"
+		}
+		return "state." + o.field
+	case o.varName != "":
+		return "$" + o.varName
+	}
+	return strconv.Quote(o.literal)
+}
+
+func TestLexCondition(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", nil},
+		{"state.Streaming == 1", []string{"state.Streaming", "==", "1"}},
+		{"Streaming=1", []string{"Streaming", "==", "1"}},
+		{"a!=b", []string{"a", "!=", "b"}},
+		{"a<=1 and b>=2", []string{"a", "<=", "1", "and", "b", ">=", "2"}},
+		{"a<1 or b>2", []string{"a", "<", "1", "or", "b", ">", "2"}},
+		{`Input = "Hymn Title"`, []string{"Input", "==", `"Hymn Title"`}},
+		{`"a=b"==x`, []string{`"a=b"`, "==", "x"}},
+		{"not (state.InputLoop[$input])", []string{"not", "(", "state.InputLoop", "[", "$input", "]", ")"}},
+		{"\tOverlay1 \t", []string{"Overlay1"}},
+	}
+	for _, tt := range tests {
+		got, err := lexCondition(tt.text)
+		if err != nil {
+			t.Errorf("lexCondition(%q): unexpected error %v", tt.text, err)
+			continue
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+			t.Errorf("lexCondition(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestParseCondition(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"state.Streaming == 1", `state.Streaming == "1"`},
+		{"Streaming = 1", `state.Streaming == "1"`},
+		{"Recording != 0", `state.Recording != "0"`},
+		{"InputVolume[2] < 50", `state.InputVolume["2"] < "50"`},
+		{"InputVolume[2] <= 50", `state.InputVolume["2"] <= "50"`},
+		{"InputVolume[2] > 50", `state.InputVolume["2"] > "50"`},
+		{"InputVolume[2] >= 50", `state.InputVolume["2"] >= "50"`},
+		{"Streaming", "state.Streaming"},
+		{"$cam", "$cam"},
+		{`Overlay1 == "Hymn Title"`, `state.Overlay1 == "Hymn Title"`},
+		{`state.InputBusBAudio["Crowd Mic"]`, `state.InputBusBAudio["Crowd Mic"]`},
+		{"InputLoop[$input]", "state.InputLoop[$input]"},
+		{"$cam == Left", `$cam == "Left"`},
+		{"not Streaming", "not state.Streaming"},
+		{"not not Streaming", "not not state.Streaming"},
+		{"Streaming and Recording or Input = 1", `((state.Streaming and state.Recording) or state.Input == "1")`},
+		{"Streaming or Recording and Input = 1", `(state.Streaming or (state.Recording and state.Input == "1"))`},
+		{"(Streaming or Recording) and Input = 1", `((state.Streaming or state.Recording) and state.Input == "1")`},
+		{"not (Streaming and Recording)", "not (state.Streaming and state.Recording)"},
+	}
+	for _, tt := range tests {
+		expr, err := parseCondition(tt.text)
+		if err != nil {
+			t.Errorf("parseCondition(%q): unexpected error %v", tt.text, err)
+			continue
+		}
+		if got := describeCond(expr); got != tt.want {
+			t.Errorf("parseCondition(%q) = %s, want %s", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestParseConditionErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"", "missing condition"},
+		{"   ", "missing condition"},
+		{`Input == "Hymn`, "unterminated string in condition"},
+		{"Streaming ==", "condition ends unexpectedly"},
+		{"Streaming and", "condition ends unexpectedly"},
+		{"state.Unknown == 1", `unknown state field "Unknown"`},
+		{"InputLoop == 1", "state.InputLoop needs an input, ex: state.InputLoop[1]"},
+		{"InputLoop[1 == 1", "missing ] after state.InputLoop"},
+		{"(Streaming or Recording", "missing ) in condition"},
+		{"Streaming Recording", `unexpected "Recording" in condition`},
+		{"== 1", `unexpected "==" in condition`},
+		{"Streaming == and", `unexpected "and" in condition`},
+		{"Streaming ! 1", `unexpected "!" in condition`},
+	}
+	for _, tt := range tests {
+		_, err := parseCondition(tt.text)
+		if err == nil {
+			t.Errorf("parseCondition(%q): expected an error", tt.text)
+			continue
+		}
+		if err.Error() != tt.want {
+			t.Errorf("parseCondition(%q): got %q, want %q", tt.text, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultConfirmTimeout is used when the Confirm column of a shortcut is set without a timeout
+const defaultConfirmTimeout = 3 * time.Second
+
+type confirmation struct {
+	lock          sync.Mutex
+	button        int
+	ignoreRelease int
+	timer         *time.Timer
+}
+
+// armedShortcut holds the shortcut that has been pressed once and is waiting for confirmation
+var armedShortcut = new(confirmation)
+
+// confirmTimeout parses the Confirm column of the Shortcuts sheet. It accepts yes/y/x for the
+// default timeout, a number of seconds or a duration such as 5s. An empty cell disables
+// confirmation.
+func confirmTimeout(cell string) time.Duration {
+	cell = strings.ToLower(strings.TrimSpace(cell))
+	switch cell {
+	case "", "no", "n":
+		return 0
+	case "yes", "y", "x", "true":
+		return defaultConfirmTimeout
+	}
+	if seconds, err := strconv.Atoi(cell); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if d, err := time.ParseDuration(cell); err == nil {
+		return d
+	}
+	return defaultConfirmTimeout
+}
+
+// confirmPress implements arm-then-fire for shortcuts that require confirmation. The first
+// press arms the shortcut and blinks its button red; a second press within the timeout fires
+// it. Pressing any other button disarms it. It returns true when the press should be processed.
+func confirmPress(button int, conf config, midiOutChan chan apcLEDS) bool {
+	// The LEDs are sent once the lock is released so a full MIDI channel can't hold it
+	armedShortcut.lock.Lock()
+	armed := armedShortcut.button
+	if armed != 0 {
+		armedShortcut.timer.Stop()
+		armedShortcut.button = 0
+	}
+
+	sc, ok := conf.shortcut[button]
+	if !ok || sc.confirm == 0 || armed == button {
+		armedShortcut.lock.Unlock()
+		if armed != 0 {
+			restoreLED(armed, conf, midiOutChan)
+		}
+		return true
+	}
+
+	debug("Arming shortcut", button)
+	armedShortcut.button = button
+	armedShortcut.ignoreRelease = button
+	armedShortcut.timer = time.AfterFunc(sc.confirm, func() {
+		armedShortcut.lock.Lock()
+		expired := armedShortcut.button == button
+		if expired {
+			armedShortcut.button = 0
+		}
+		armedShortcut.lock.Unlock()
+		if expired {
+			debug("Shortcut", button, "was not confirmed")
+			restoreLED(button, conf, midiOutChan)
+		}
+	})
+	armedShortcut.lock.Unlock()
+
+	if armed != 0 {
+		restoreLED(armed, conf, midiOutChan)
+	}
+	midiOutChan <- apcLEDS{
+		buttons: []int{button},
+		color:   "redBlink",
+	}
+	return false
+}
+
+// confirmRelease returns false for the release of a press that only armed a shortcut
+func confirmRelease(button int) bool {
+	armedShortcut.lock.Lock()
+	defer armedShortcut.lock.Unlock()
+	if armedShortcut.ignoreRelease == button {
+		armedShortcut.ignoreRelease = 0
+		return false
+	}
+	return true
+}
+
+// restoreLED returns a button to its initial color
+func restoreLED(button int, conf config, midiOutChan chan apcLEDS) {
+	color := conf.initial[button]
+	if color == "" {
+		color = "off"
+	}
+	midiOutChan <- apcLEDS{
+		buttons: []int{button},
+		color:   color,
+	}
+}
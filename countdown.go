@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// countdown is the clock of the time left until the service begins, shown in a title
+type countdown struct {
+	lock      sync.Mutex
+	running   bool
+	paused    bool
+	target    time.Time
+	remaining time.Duration
+	done      bool
+	actions   *script
+}
+
+var serviceCountdown = new(countdown)
+
+// loadCountdown parses the settings of the countdown that can't be checked at runtime
+func loadCountdown(conf config) {
+	var err error
+	serviceCountdown.actions, err = parseScript(conf.misc["Countdown Actions"])
+	if err != nil {
+		fmt.Println("Error in Settings, Countdown Actions:", err)
+	}
+	if target := conf.misc["Countdown Target"]; target != "" {
+		if _, err := countdownTarget(target, time.Now()); err != nil {
+			fmt.Println("Error in Settings, Countdown Target:", err)
+		}
+	}
+}
+
+// countdownTarget returns the end of a countdown to a time of day (10:00) or for a duration (5m).
+// A plain number is a number of minutes.
+func countdownTarget(target string, now time.Time) (time.Time, error) {
+	target = strings.TrimSpace(target)
+	if minutes, err := strconv.Atoi(target); err == nil && minutes >= 0 {
+		return now.Add(time.Duration(minutes) * time.Minute), nil
+	}
+	if d, err := time.ParseDuration(target); err == nil && d >= 0 {
+		return now.Add(d), nil
+	}
+	e := new(scheduleEntry)
+	if err := parseScheduleTime(e, target); err != nil || e.cond != nil {
+		return time.Time{}, fmt.Errorf("expected a time of day or a duration, ex: 10:00 or 5m")
+	}
+	return e.nextRun(now), nil
+}
+
+// countdownCommand performs the countdown commands of the action language
+func countdownCommand(conf config, args []string) {
+	if len(args) == 0 {
+		return
+	}
+	c := serviceCountdown
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	switch args[0] {
+	case "start":
+		if c.paused && len(args) == 1 {
+			c.target = time.Now().Add(c.remaining)
+			c.paused = false
+			return
+		}
+		target := conf.misc["Countdown Target"]
+		if len(args) > 1 {
+			target = strings.Join(args[1:], " ")
+		}
+		end, err := countdownTarget(target, time.Now())
+		if err != nil {
+			fmt.Println("Unable to start the countdown:", err)
+			return
+		}
+		c.target = end
+		c.running = true
+		c.paused = false
+		c.done = false
+	case "pause":
+		if c.running && !c.paused {
+			c.remaining = time.Until(c.target)
+			c.paused = true
+		} else if c.paused {
+			c.target = time.Now().Add(c.remaining)
+			c.paused = false
+		}
+	case "reset":
+		c.running = false
+		c.paused = false
+		c.done = false
+		c.remaining = 0
+	}
+}
+
+// checkCountdownCommand validates a countdown command when the configuration is loaded
+func checkCountdownCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected 'countdown start|pause|reset'")
+	}
+	switch args[0] {
+	case "start":
+		if len(args) > 1 && !strings.Contains(args[1], "$") {
+			_, err := countdownTarget(strings.Join(args[1:], " "), time.Now())
+			return err
+		}
+	case "pause", "reset":
+		if len(args) > 1 {
+			return fmt.Errorf("countdown %s takes no arguments", args[0])
+		}
+	default:
+		return fmt.Errorf("expected 'countdown start|pause|reset'")
+	}
+	return nil
+}
+
+// countdownButton handles the buttons of the countdown. It returns false when the button is
+// not one of them.
+func countdownButton(conf config, button int) bool {
+	start, _ := strconv.Atoi(conf.misc["Countdown Button"])
+	reset, _ := strconv.Atoi(conf.misc["Countdown Reset Button"])
+
+	switch button {
+	case 0:
+		return false
+	case start:
+		serviceCountdown.lock.Lock()
+		running := serviceCountdown.running
+		serviceCountdown.lock.Unlock()
+		if running {
+			countdownCommand(conf, []string{"pause"})
+		} else {
+			countdownCommand(conf, []string{"start"})
+		}
+		return true
+	case reset:
+		countdownCommand(conf, []string{"reset"})
+		return true
+	}
+	return false
+}
+
+// formatCountdown shows the time left as mm:ss, or h:mm:ss for an hour or more
+func formatCountdown(left time.Duration) string {
+	seconds := int((left + time.Second - 1) / time.Second)
+	if seconds < 0 {
+		seconds = 0
+	}
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+}
+
+// runCountdown updates the countdown title once per second. This is a blocking function.
+func runCountdown(client *vmixClient, conf config, vmixState *state, midiOutChan chan apcLEDS,
+	verseChan chan verses) {
+	title := conf.misc["Countdown Title"]
+	if title == "" {
+		return
+	}
+	textbox := conf.misc["Countdown Textbox"]
+	if textbox == "" {
+		vmixState.lock.RLock()
+		textbox = vmixState.overlayTBNames[title]
+		vmixState.lock.RUnlock()
+	}
+	text := conf.misc["Countdown Text"]
+	if text == "" {
+		text = "{time}"
+	}
+	button, _ := strconv.Atoi(conf.misc["Countdown Button"])
+
+	shownText := ""
+	shownColor := ""
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		c := serviceCountdown
+		c.lock.Lock()
+		left := c.remaining
+		if c.running && !c.paused {
+			left = time.Until(c.target)
+		}
+		running := c.running
+		finished := running && !c.paused && left <= 0
+		if finished {
+			// Keep showing 00:00 until the countdown is reset or started again
+			c.running = false
+			c.done = true
+		}
+		visible := running || c.done
+		color := "off"
+		switch {
+		case running && c.paused:
+			color = "yellow"
+		case running && left <= time.Minute:
+			color = "redBlink"
+		case running:
+			color = "green"
+		}
+		c.lock.Unlock()
+
+		value := ""
+		if visible {
+			value = strings.Replace(text, "{time}", formatCountdown(left), -1)
+		}
+		if value != shownText {
+			shownText = value
+			_ = SendMessage(client, "FUNCTION SetText Input="+url.QueryEscape(title)+"&SelectedName="+
+				url.QueryEscape(textbox)+"&Value="+url.QueryEscape(value))
+		}
+
+		if finished {
+			debug("Countdown finished")
+			color = "off"
+			runScript(c.actions, newActionEnv(client, conf, vmixState, midiOutChan, verseChan, button))
+		}
+
+		if button != 0 && color != shownColor {
+			shownColor = color
+			if color == "off" {
+				restoreLED(button, conf, midiOutChan)
+			} else {
+				midiOutChan <- apcLEDS{
+					buttons: []int{button},
+					color:   color,
+				}
+			}
+		}
+	}
+}
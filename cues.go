@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"github.com/360EntSecGroup-Skylar/excelize/v2"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type cue struct {
+	name     string
+	camera   string
+	preset   string
+	input    string
+	overlay  string
+	verses   int
+	micScene string
+	actions  *script
+}
+
+// runOfShow is the position in the Run of Show sheet. -1 is before the first cue.
+var runOfShow = struct {
+	lock     sync.Mutex
+	position int
+}{position: -1}
+
+// loadCues reads the Run of Show sheet, one cue per row in the order of the service
+func loadCues(wb *excelize.File, conf config) []*cue {
+	var cues []*cue
+	rows, _ := wb.GetRows("Run of Show")
+	for idx, row := range rows {
+		if idx == 0 || len(row) == 0 || row[0] == "" {
+			continue
+		}
+		for len(row) < 8 {
+			row = append(row, "")
+		}
+
+		c := &cue{
+			name:     row[0],
+			camera:   strings.ToLower(row[1]),
+			preset:   row[2],
+			input:    row[3],
+			overlay:  row[4],
+			micScene: strings.ToLower(row[6]),
+		}
+		var err error
+		if row[5] != "" {
+			c.verses, err = strconv.Atoi(row[5])
+		}
+		if err == nil {
+			err = checkCue(c, conf)
+		}
+		if err == nil {
+			c.actions, err = parseScript(row[7])
+		}
+		if err != nil {
+			fmt.Println("Error in Run of Show, cue", c.name+":", err)
+			continue
+		}
+		cues = append(cues, c)
+	}
+	return cues
+}
+
+func checkCue(c *cue, conf config) error {
+	if c.camera != "" {
+		if _, ok := conf.camera[c.camera]; !ok {
+			return fmt.Errorf("unknown camera %q", c.camera)
+		}
+		if c.preset == "" {
+			return fmt.Errorf("missing preset for camera %s", c.camera)
+		}
+	}
+	if c.verses != 0 {
+		_, isHymn := conf.hymn[c.verses]
+		_, isPrayer := conf.prayer[c.verses]
+		_, isPop := conf.pop[c.verses]
+		_, isReading := conf.reading[c.verses]
+		if !isHymn && !isPrayer && !isPop && !isReading {
+			return fmt.Errorf("button %d has no verses", c.verses)
+		}
+	}
+	if c.micScene != "" {
+		if _, ok := conf.micScene[c.micScene]; !ok {
+			return fmt.Errorf("unknown mic scene %q", c.micScene)
+		}
+	}
+	return nil
+}
+
+// cueCommand moves through the run of show: cue go, cue back, or cue followed by the name of
+// a cue to jump to.
+func cueCommand(env *actionEnv, arg string) {
+	cues := env.conf.cues
+	if len(cues) == 0 {
+		return
+	}
+
+	runOfShow.lock.Lock()
+	position := runOfShow.position
+	switch strings.ToLower(arg) {
+	case "go":
+		position++
+	case "back":
+		position--
+	default:
+		position = -1
+		for i, c := range cues {
+			if strings.EqualFold(c.name, arg) {
+				position = i
+			}
+		}
+		if position < 0 {
+			runOfShow.lock.Unlock()
+			debug("Unknown cue:", arg)
+			return
+		}
+	}
+	if position < 0 || position >= len(cues) {
+		runOfShow.lock.Unlock()
+		return
+	}
+	runOfShow.position = position
+	runOfShow.lock.Unlock()
+
+	runCue(env, cues[position])
+	showCues(env.conf, env.midiOutChan)
+}
+
+// runCue sets up everything listed in a cue
+func runCue(env *actionEnv, c *cue) {
+	debug("Cue:", c.name)
+	conf := env.conf
+
+	if cameraConfig, ok := conf.camera[c.camera]; ok {
+		go cameraPreset(cameraConfig, c.preset)
+	}
+	if c.input != "" {
+		_ = SendMessage(env.client, "FUNCTION CutDirect Input="+url.QueryEscape(c.input))
+	}
+	// The Cues row of the Overlays sheet sets the channel and transitions, nil gives the defaults
+	ov := conf.overlay["cues"]
+	if strings.EqualFold(c.overlay, "off") {
+		_ = SendMessage(env.client, ov.hideFunction())
+	} else if c.overlay != "" {
+		overlayShown(ov, conf, env.midiOutChan)
+		_ = SendMessage(env.client, ov.showFunction(c.overlay))
+	}
+	if c.verses != 0 {
+		startVerses(conf, c.verses, env.verseChan)
+	}
+	if scene, ok := conf.micScene[c.micScene]; ok {
+		recallMicScene(env.client, scene, conf, env.midiOutChan)
+	}
+	runScript(c.actions, env)
+}
+
+// cueButton handles the Cue Go and Cue Back buttons. It returns false when the button is
+// neither.
+func cueButton(env *actionEnv, button int) bool {
+	goButton, _ := strconv.Atoi(env.conf.misc["Cue Go Button"])
+	backButton, _ := strconv.Atoi(env.conf.misc["Cue Back Button"])
+
+	switch button {
+	case 0:
+		return false
+	case goButton:
+		cueCommand(env, "go")
+		return true
+	case backButton:
+		cueCommand(env, "back")
+		return true
+	}
+	return false
+}
+
+// showCues lights the preview row with the current cue and the ones that follow it
+func showCues(conf config, midiOutChan chan apcLEDS) {
+	row, err := strconv.Atoi(conf.misc["Cue Preview Row"])
+	if err != nil || row < 1 || row > 8 {
+		return
+	}
+
+	runOfShow.lock.Lock()
+	position := runOfShow.position
+	runOfShow.lock.Unlock()
+
+	colors := map[string][]int{}
+	for i := 0; i < 8; i++ {
+		button := (row-1)*8 + i + 1
+		cue := position + i
+		color := "off"
+		switch {
+		case cue < 0 || cue >= len(conf.cues):
+		case i == 0:
+			color = "red"
+		case i == 1:
+			color = "green"
+		default:
+			color = "yellow"
+		}
+		colors[color] = append(colors[color], button)
+	}
+	for color, buttons := range colors {
+		midiOutChan <- apcLEDS{
+			buttons: buttons,
+			color:   color,
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"github.com/360EntSecGroup-Skylar/excelize/v2"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type duckRule struct {
+	name      string
+	trigger   string
+	channel   int
+	source    string
+	threshold float64
+	targets   []string
+	duck      float64
+	ramp      int
+	hold      int
+}
+
+type ducker struct {
+	client    *vmixClient
+	vmixState *state
+	rules     map[string]*duckRule
+	ducked    map[int]float64
+	saved     map[int]float64
+	releaseAt map[int]time.Time
+}
+
+// loadDucking reads the ducking rules from the Ducking sheet, one rule per row
+func loadDucking(wb *excelize.File, conf config, vmixState *state) {
+	rows, _ := wb.GetRows("Ducking")
+	for idx, row := range rows {
+		if idx == 0 || len(row) < 6 || row[0] == "" {
+			continue
+		}
+
+		rule := new(duckRule)
+		rule.name = row[0]
+		rule.trigger = strings.ToLower(row[1])
+		rule.threshold, _ = strconv.ParseFloat(row[3], 64)
+		rule.duck, _ = strconv.ParseFloat(row[5], 64)
+		rule.duck = math.Abs(rule.duck)
+		if len(row) > 6 {
+			rule.ramp, _ = strconv.Atoi(row[6])
+		}
+		if len(row) > 7 {
+			rule.hold, _ = strconv.Atoi(row[7])
+		}
+
+		// Sources and targets are kept by name and looked up when the rule is evaluated, so
+		// inputs can be renumbered in vMix
+		source := row[2]
+		switch rule.trigger {
+		case "overlay":
+			if channel, err := strconv.Atoi(source); err == nil && channel >= 1 && channel <= 4 {
+				rule.channel = channel
+			} else {
+				rule.source = source
+			}
+		case "mic":
+			if input, ok := conf.mics[source]; ok {
+				source = input
+			}
+			rule.source = source
+		case "level":
+			rule.source = source
+		default:
+			fmt.Println("Error in ducking rule", rule.name+": unknown trigger", row[1])
+			continue
+		}
+
+		if rule.channel == 0 && inputNumber(vmixState, rule.source) == 0 {
+			fmt.Println("Error in ducking rule", rule.name+": unknown source", row[2])
+			continue
+		}
+
+		for _, target := range strings.Split(row[4], ",") {
+			target = strings.TrimSpace(target)
+			if inputNumber(vmixState, target) != 0 {
+				rule.targets = append(rule.targets, target)
+			} else {
+				fmt.Println("Error in ducking rule", rule.name+": unknown target", target)
+			}
+		}
+
+		conf.ducking[rule.name] = rule
+	}
+}
+
+// inputNumber translates an input given by name or number to its input number. It returns 0
+// when the input is unknown.
+func inputNumber(vmixState *state, input string) int {
+	vmixState.lock.RLock()
+	defer vmixState.lock.RUnlock()
+	if inputNum, ok := vmixState.nameToNumber[input]; ok {
+		input = inputNum
+	}
+	number, _ := strconv.Atoi(input)
+	return number
+}
+
+// volumeToDB converts a vMix volume (0-100) to dB. vMix volumes are on a
+// logarithmic scale where the amplitude is (volume/100)^4.
+func volumeToDB(volume float64) float64 {
+	if volume <= 0 {
+		return math.Inf(-1)
+	}
+	return 80 * math.Log10(volume/100)
+}
+
+// dbToVolume converts a gain in dB to a vMix volume (0-100)
+func dbToVolume(db float64) float64 {
+	return math.Min(100, 100*math.Pow(10, db/80))
+}
+
+// runDucking evaluates the ducking rules whenever the vMix state changes, and every 200ms to
+// follow audio levels and release ducked inputs once their hold time has passed.
+// This is a blocking function.
+func runDucking(vc vcConfig, client *vmixClient, vmixState *state, conf config) {
+	if len(conf.ducking) == 0 {
+		return
+	}
+
+	d := ducker{
+		client:    client,
+		vmixState: vmixState,
+		rules:     conf.ducking,
+		ducked:    make(map[int]float64),
+		saved:     make(map[int]float64),
+		releaseAt: make(map[int]time.Time),
+	}
+
+	// Audio levels are not part of the activator feed, so poll them from the XML state over a
+	// connection of our own.
+	var meterClient *vmixClient
+	for _, rule := range d.rules {
+		if rule.trigger == "level" {
+			var err error
+			meterClient, err = vmixAPIConnect(vc)
+			if err != nil {
+				fmt.Println("Error connecting to the vMix API, level ducking is disabled:", err)
+				meterClient = nil
+			}
+			break
+		}
+	}
+
+	events := subscribe(vmixState)
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-events:
+		case <-ticker.C:
+			if meterClient != nil {
+				updateMeters(meterClient, vmixState)
+			}
+		}
+		d.evaluate()
+	}
+}
+
+// updateMeters refreshes the audio meters of all inputs from the vMix XML state
+func updateMeters(client *vmixClient, vmixState *state) {
+	doc := readVmixXML(client)
+	vmixState.lock.Lock()
+	defer vmixState.lock.Unlock()
+	for _, input := range doc.FindElements("./vmix/inputs/*") {
+		number, _ := strconv.Atoi(input.SelectAttrValue("number", ""))
+		vmixState.InputMeter[number] = inputMeter(input)
+	}
+}
+
+// active reports whether the trigger of a rule is currently met
+func (d *ducker) active(rule *duckRule) bool {
+	input := inputNumber(d.vmixState, rule.source)
+	d.vmixState.lock.RLock()
+	defer d.vmixState.lock.RUnlock()
+
+	switch rule.trigger {
+	case "overlay":
+		if rule.channel != 0 {
+			return overlayInput(d.vmixState, rule.channel) != 0
+		}
+		if input == 0 {
+			return false
+		}
+		for channel := 1; channel <= 4; channel++ {
+			if overlayInput(d.vmixState, channel) == input {
+				return true
+			}
+		}
+	case "mic":
+		// Microphones are switched with AudioBusOn M, not by muting them
+		return busAudio(d.vmixState, "M")[input]
+	case "level":
+		return 20*math.Log10(d.vmixState.InputMeter[input]) > rule.threshold
+	}
+	return false
+}
+
+func (d *ducker) evaluate() {
+	wanted := make(map[int]float64)
+	for _, rule := range d.rules {
+		if d.active(rule) {
+			for _, target := range d.targetInputs(rule) {
+				wanted[target] = math.Max(wanted[target], rule.duck)
+				d.releaseAt[target] = time.Now().Add(time.Duration(rule.hold) * time.Millisecond)
+			}
+		}
+	}
+
+	for target, duck := range wanted {
+		if d.ducked[target] == duck {
+			continue
+		}
+		if _, ok := d.ducked[target]; !ok {
+			d.vmixState.lock.RLock()
+			d.saved[target] = d.vmixState.InputVolume[target]
+			d.vmixState.lock.RUnlock()
+		}
+		d.ducked[target] = duck
+		volume := dbToVolume(volumeToDB(d.saved[target]) - duck)
+		debug("Ducking input", target, "by", duck, "dB")
+		d.fade(target, volume, d.rampFor(target))
+	}
+
+	for target := range d.ducked {
+		if _, ok := wanted[target]; ok || time.Now().Before(d.releaseAt[target]) {
+			continue
+		}
+		debug("Restoring ducked input", target)
+		d.fade(target, d.saved[target], d.rampFor(target))
+		delete(d.ducked, target)
+		delete(d.saved, target)
+		delete(d.releaseAt, target)
+	}
+}
+
+// rampFor returns the longest ramp time of the rules that duck the target
+func (d *ducker) rampFor(target int) int {
+	ramp := 0
+	for _, rule := range d.rules {
+		for _, t := range d.targetInputs(rule) {
+			if t == target && rule.ramp > ramp {
+				ramp = rule.ramp
+			}
+		}
+	}
+	return ramp
+}
+
+// targetInputs returns the input numbers of the targets of a rule that are known to vMix
+func (d *ducker) targetInputs(rule *duckRule) []int {
+	var inputs []int
+	for _, target := range rule.targets {
+		if input := inputNumber(d.vmixState, target); input != 0 {
+			inputs = append(inputs, input)
+		}
+	}
+	return inputs
+}
+
+func (d *ducker) fade(input int, volume float64, ramp int) {
+	m := "FUNCTION SetVolumeFade Input=" + strconv.Itoa(input) + "&Value=" +
+		strconv.Itoa(int(math.Round(volume))) + "," + strconv.Itoa(ramp)
+	_ = SendMessage(d.client, m)
+}
+
+// overlayInput returns the input on an overlay channel, or 0 when the channel is empty.
+// The caller must hold the state lock.
+func overlayInput(vmixState *state, channel int) int {
+	switch channel {
+	case 1:
+		return vmixState.Overlay1
+	case 2:
+		return vmixState.Overlay2
+	case 3:
+		return vmixState.Overlay3
+	case 4:
+		return vmixState.Overlay4
+	case 5:
+		return vmixState.Overlay5
+	case 6:
+		return vmixState.Overlay6
+	}
+	return 0
+}
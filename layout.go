@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"github.com/360EntSecGroup-Skylar/excelize/v2"
+	"strconv"
+	"strings"
+)
+
+type titleLayout struct {
+	maxLines int
+	maxChars int
+}
+
+// loadTitleLayouts reads the Title Layout sheet, which sets how much text fits in a title
+func loadTitleLayouts(wb *excelize.File, conf config, vmixState *state) {
+	rows, _ := wb.GetRows("Title Layout")
+	for idx, row := range rows {
+		if idx == 0 || len(row) < 2 || row[0] == "" {
+			continue
+		}
+
+		input := resolveInput(vmixState, row[0])
+
+		layout := new(titleLayout)
+		var err error
+		if row[1] != "" {
+			layout.maxLines, err = strconv.Atoi(row[1])
+		}
+		if err == nil && len(row) > 2 && row[2] != "" {
+			layout.maxChars, err = strconv.Atoi(row[2])
+		}
+		if err != nil || layout.maxLines < 0 || layout.maxChars < 0 {
+			fmt.Println("Error in Title Layout,", row[0]+": the limits must be numbers")
+			continue
+		}
+		conf.layout[strings.ToLower(input)] = layout
+	}
+}
+
+// paginate wraps and splits the verses shown in a title into pages that fit the title
+func paginate(conf config, input string, verses []string) []string {
+	layout, ok := conf.layout[strings.ToLower(input)]
+	if !ok {
+		return verses
+	}
+
+	var pages []string
+	for _, verse := range verses {
+		if strings.TrimSpace(verse) == "" {
+			pages = append(pages, verse)
+			continue
+		}
+		pages = append(pages, layout.split(verse)...)
+	}
+	return pages
+}
+
+// split splits a verse into pages. The lines are shared evenly between the pages so that a
+// verse one line too long doesn't leave a single line on its last page.
+func (layout *titleLayout) split(verse string) []string {
+	var lines []string
+	for _, line := range strings.Split(verse, "\n") {
+		lines = append(lines, wrapLine(strings.TrimSpace(line), layout.maxChars)...)
+	}
+	if layout.maxLines == 0 || len(lines) <= layout.maxLines {
+		return []string{strings.Join(lines, "\n")}
+	}
+
+	count := (len(lines) + layout.maxLines - 1) / layout.maxLines
+	perPage := (len(lines) + count - 1) / count
+	var pages []string
+	for start := 0; start < len(lines); start += perPage {
+		end := start + perPage
+		if end > len(lines) {
+			end = len(lines)
+		}
+		pages = append(pages, strings.Join(lines[start:end], "\n"))
+	}
+	return pages
+}
+
+// wrapLine wraps a line at word boundaries. Words longer than a line are cut.
+func wrapLine(line string, maxChars int) []string {
+	if maxChars == 0 || len([]rune(line)) <= maxChars {
+		return []string{line}
+	}
+
+	var lines []string
+	current := ""
+	for _, word := range strings.Fields(line) {
+		for len([]rune(word)) > maxChars {
+			if current != "" {
+				lines = append(lines, current)
+				current = ""
+			}
+			lines = append(lines, string([]rune(word)[:maxChars]))
+			word = string([]rune(word)[maxChars:])
+		}
+		switch {
+		case current == "":
+			current = word
+		case len([]rune(current))+1+len([]rune(word)) <= maxChars:
+			current += " " + word
+		default:
+			lines = append(lines, current)
+			current = word
+		}
+	}
+	if current != "" {
+		lines = append(lines, current)
+	}
+	return lines
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// lectionaryDay is the day of the liturgical calendar the readings are for and its readings
+type lectionaryDay struct {
+	name     string
+	year     string
+	readings map[string]string
+}
+
+var lectionaryReference = regexp.MustCompile(`(?i)^lectionary\s+(.+)$`)
+
+// dayAliases are other names of the days that may be used in a lectionary file
+var dayAliases = map[string]string{
+	"baptism of the lord":    "epiphany 1",
+	"epiphany of the lord":   "epiphany",
+	"transfiguration sunday": "transfiguration",
+	"liturgy of the palms":   "palm sunday",
+	"passion sunday":         "palm sunday",
+	"easter day":             "easter",
+	"easter sunday":          "easter",
+	"ascension day":          "ascension",
+	"day of pentecost":       "pentecost",
+	"trinity sunday":         "trinity",
+	"christ the king":        "proper 29",
+	"reign of christ":        "proper 29",
+}
+
+// loadLectionary finds the readings of the day in the lectionary file. It returns nil when no
+// lectionary is configured.
+func loadLectionary(path string, date string) *lectionaryDay {
+	if path == "" {
+		return nil
+	}
+	day, err := lectionaryDate(date, time.Now())
+	if err != nil {
+		fmt.Println("Error in Settings, Lectionary Date:", err)
+		return nil
+	}
+	lect := &lectionaryDay{readings: make(map[string]string)}
+	lect.name, lect.year = liturgicalDay(day)
+	debug("Lectionary:", day.Format("2006-01-02"), lect.name, "Year", lect.year)
+
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Println("Error reading the lectionary:", err)
+		return nil
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".tsv", ".txt":
+		r.Comma = '\t'
+	}
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	rows, err := r.ReadAll()
+	if err != nil {
+		fmt.Println("Error reading the lectionary:", err)
+		return nil
+	}
+	if len(rows) < 2 || len(rows[0]) < 3 {
+		fmt.Println("Error reading the lectionary: it needs a header row of Day, Year and the readings")
+		return nil
+	}
+
+	// A row for the date wins over one for the day and year, which wins over one for every year
+	best := 0
+	for _, row := range rows[1:] {
+		if len(row) < 3 {
+			continue
+		}
+		rowDay := strings.TrimSpace(row[0])
+		rowYear := strings.ToUpper(strings.TrimSpace(row[1]))
+		rank := 0
+		switch {
+		case rowDay == day.Format("2006-01-02"):
+			rank = 3
+		case lect.name == "" || dayName(rowDay) != lect.name:
+		case rowYear == lect.year:
+			rank = 2
+		case rowYear == "" || rowYear == "ABC":
+			rank = 1
+		}
+		if rank <= best {
+			continue
+		}
+		best = rank
+		lect.readings = make(map[string]string)
+		for i, column := range rows[0] {
+			if i > 1 && i < len(row) {
+				lect.readings[strings.ToLower(strings.TrimSpace(column))] = strings.TrimSpace(row[i])
+			}
+		}
+	}
+	if best == 0 {
+		fmt.Println("Error reading the lectionary: no readings for", lect.name, "Year", lect.year)
+	}
+	return lect
+}
+
+// lectionaryReading returns the reference of a reading given as "Lectionary Gospel". Other
+// references are returned as they are.
+func lectionaryReading(lect *lectionaryDay, reference string) (string, error) {
+	m := lectionaryReference.FindStringSubmatch(strings.TrimSpace(reference))
+	if m == nil {
+		return reference, nil
+	}
+	if lect == nil {
+		return "", fmt.Errorf("no Lectionary File in the Settings sheet")
+	}
+	column := strings.ToLower(strings.TrimSpace(m[1]))
+	if lect.readings[column] == "" {
+		return "", fmt.Errorf("no %s reading for %s Year %s in the lectionary", m[1], lect.name, lect.year)
+	}
+	return lect.readings[column], nil
+}
+
+// lectionaryDate returns the day the readings are for
+func lectionaryDate(setting string, now time.Time) (time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	switch strings.ToLower(strings.TrimSpace(setting)) {
+	case "":
+		return today.AddDate(0, 0, (7-int(today.Weekday()))%7), nil
+	case "today":
+		return today, nil
+	}
+	return time.Parse("2006-01-02", strings.TrimSpace(setting))
+}
+
+// dayName puts the name of a day as it is written in a lectionary file in the form used by
+// liturgicalDay
+func dayName(name string) string {
+	name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+	if alias, ok := dayAliases[name]; ok {
+		return alias
+	}
+	return name
+}
+
+// easter returns the date of Easter in a year (Gregorian calendar, anonymous algorithm)
+func easter(year int) time.Time {
+	a := year % 19
+	b := year / 100
+	c := year % 100
+	d := b / 4
+	e := b % 4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i := c / 4
+	k := c % 4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
+
+// firstAdvent returns the first Sunday of Advent of a year, four Sundays before Christmas
+func firstAdvent(year int) time.Time {
+	christmas := time.Date(year, time.December, 25, 0, 0, 0, 0, time.UTC)
+	daysBack := int(christmas.Weekday())
+	if daysBack == 0 {
+		daysBack = 7
+	}
+	return christmas.AddDate(0, 0, -daysBack-21)
+}
+
+// liturgicalDay returns the name of a day in the liturgical calendar and the lectionary year
+// (A, B or C). The name is empty for a weekday that isn't a feast.
+func liturgicalDay(date time.Time) (string, string) {
+	date = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	year := date.Year()
+	weeks := func(from time.Time) int {
+		return int(date.Sub(from).Hours()/24) / 7
+	}
+
+	// The liturgical year starts on the first Sunday of Advent. Year A starts in 2022, 2025, ...
+	advent := firstAdvent(year)
+	startYear := year - 1
+	if !date.Before(advent) {
+		startYear = year
+	}
+	letter := string("CAB"[(startYear+1)%3])
+
+	easterDay := easter(year)
+	fromEaster := int(date.Sub(easterDay).Hours() / 24)
+	sunday := date.Weekday() == time.Sunday
+
+	switch {
+	case date.Month() == time.December && date.Day() == 24 && !sunday:
+		// On a Sunday it is Advent 4. A row for the date can give the Christmas Eve readings.
+		return "christmas eve", letter
+	case date.Month() == time.December && date.Day() == 25:
+		return "christmas day", letter
+	case date.Month() == time.January && date.Day() == 6:
+		return "epiphany", letter
+	case fromEaster == -46:
+		return "ash wednesday", letter
+	case fromEaster == -3:
+		return "maundy thursday", letter
+	case fromEaster == -2:
+		return "good friday", letter
+	case fromEaster == 39:
+		return "ascension", letter
+	case !sunday:
+		return "", letter
+	case !date.Before(advent):
+		if date.Month() == time.December && date.Day() > 25 {
+			return "christmas 1", letter
+		}
+		return fmt.Sprintf("advent %d", weeks(advent)+1), letter
+	case date.Month() == time.January && date.Day() < 6:
+		// Christmas 1 is the Sunday after Christmas Day, which may be January 1
+		if date.Day() == 1 {
+			return "christmas 1", letter
+		}
+		return "christmas 2", letter
+	case fromEaster < -49:
+		baptism := time.Date(year, time.January, 7, 0, 0, 0, 0, time.UTC)
+		for baptism.Weekday() != time.Sunday {
+			baptism = baptism.AddDate(0, 0, 1)
+		}
+		return fmt.Sprintf("epiphany %d", weeks(baptism)+1), letter
+	case fromEaster == -49:
+		return "transfiguration", letter
+	case fromEaster < -7:
+		return fmt.Sprintf("lent %d", (fromEaster+42)/7+1), letter
+	case fromEaster == -7:
+		return "palm sunday", letter
+	case fromEaster == 0:
+		return "easter", letter
+	case fromEaster < 49:
+		return fmt.Sprintf("easter %d", fromEaster/7+1), letter
+	case fromEaster == 49:
+		return "pentecost", letter
+	case fromEaster == 56:
+		return "trinity", letter
+	}
+	// Proper 1 is the Sunday from May 8 to May 14, and each Proper is a week later. Trinity is
+	// never before May 17, so the Propers after it are never before Proper 1.
+	return fmt.Sprintf("proper %d", weeks(time.Date(year, time.May, 8, 0, 0, 0, 0, time.UTC))+1), letter
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"fmt"
+	"github.com/beevik/etree"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// song is a hymn imported from a lyric file of the Lyrics Folder
+type song struct {
+	number  string
+	title   string
+	authors []string
+	verses  []string
+}
+
+var (
+	chordPattern  = regexp.MustCompile(`\[[^\]]*\]`)
+	labelPattern  = regexp.MustCompile(`(?i)^[\[(]?((verse|chorus|refrain|bridge|pre-chorus|ending|tag)\s*\d*)[\])]?:?$`)
+	repeatPattern = regexp.MustCompile(`(?i)^[\[(]?(?:x\s*(\d+)|(\d+)\s*x|repeat)[\])]?$`)
+	songFileName  = regexp.MustCompile(`^(\d+)[\s._-]*(.*)$`)
+	hymnReference = regexp.MustCompile(`(?i)^hymn\s+(.+)$`)
+	whitespace    = regexp.MustCompile(`\s+`)
+)
+
+// songLibrary holds the imported songs by number and by lower case title
+type songLibrary map[string]*song
+
+// loadSongs reads all the lyric files of a folder
+func loadSongs(folder string) songLibrary {
+	library := make(songLibrary)
+	if folder == "" {
+		return library
+	}
+
+	files, err := os.ReadDir(folder)
+	if err != nil {
+		fmt.Println("Error reading the lyrics folder:", err)
+		return library
+	}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		path := filepath.Join(folder, f.Name())
+		var s *song
+		switch strings.ToLower(filepath.Ext(f.Name())) {
+		case ".txt":
+			s, err = readTextSong(path, false)
+		case ".cho", ".crd", ".chopro", ".pro":
+			s, err = readTextSong(path, true)
+		case ".xml":
+			s, err = readOpenLyrics(path)
+		default:
+			continue
+		}
+		if err != nil {
+			fmt.Println("Error reading lyrics", f.Name()+":", err)
+			continue
+		}
+		library.add(s, f.Name())
+	}
+	debug("Imported", len(library), "song names and numbers from", folder)
+	return library
+}
+
+// add indexes a song by its number and title. Missing ones are taken from the file name.
+func (library songLibrary) add(s *song, fileName string) {
+	name := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	if m := songFileName.FindStringSubmatch(name); m != nil {
+		if s.number == "" {
+			s.number = m[1]
+		}
+		name = m[2]
+	}
+	if s.title == "" {
+		s.title = name
+	}
+	if len(s.verses) == 0 {
+		return
+	}
+	if s.number != "" {
+		library[s.number] = s
+	}
+	library[strings.ToLower(s.title)] = s
+}
+
+// find returns the song for a hymn reference such as "Hymn 390" or "Hymn Amazing Grace"
+func (library songLibrary) find(reference string) (*song, bool) {
+	m := hymnReference.FindStringSubmatch(strings.TrimSpace(reference))
+	if m == nil {
+		return nil, false
+	}
+	key := strings.ToLower(strings.TrimSpace(m[1]))
+	if s, ok := library[key]; ok {
+		return s, true
+	}
+	// Numbers are matched without leading zeros, ex: Hymn 7 and 007 Lord of All.txt
+	if n, err := strconv.Atoi(key); err == nil {
+		for _, s := range library {
+			if number, err := strconv.Atoi(s.number); err == nil && number == n {
+				return s, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// pages returns the verses to show for a song, starting with its title when titlePage is set
+func (s *song) pages(titlePage bool) []string {
+	if !titlePage {
+		return s.verses
+	}
+	title := s.title
+	if len(s.authors) > 0 {
+		title += "\n" + strings.Join(s.authors, ", ")
+	}
+	return append([]string{title}, s.verses...)
+}
+
+func readTextSong(path string, chordPro bool) (*song, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := new(song)
+	lines := strings.Split(strings.Replace(string(data), "\r\n", "\n", -1), "\n")
+
+	labeled := make(map[string]string)
+	lastChorus := ""
+	var paragraph []string
+	inChorus := false
+
+	flush := func() {
+		text, label, repeat := parseParagraph(paragraph, inChorus)
+		paragraph = nil
+		switch {
+		case text == "" && label != "":
+			// A label on its own repeats the paragraph with that label
+			if previous, ok := labeled[label]; ok {
+				text = previous
+			} else if strings.HasPrefix(label, "chorus") || strings.HasPrefix(label, "refrain") {
+				text = lastChorus
+			}
+		case text != "" && label != "":
+			labeled[label] = text
+			if strings.HasPrefix(label, "chorus") || strings.HasPrefix(label, "refrain") {
+				lastChorus = text
+			}
+		}
+		for i := 0; text != "" && i < repeat; i++ {
+			s.verses = append(s.verses, text)
+		}
+	}
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if chordPro {
+			if strings.HasPrefix(line, "#") {
+				continue
+			}
+			if strings.HasPrefix(line, "{") && strings.HasSuffix(line, "}") {
+				name, value := chordProDirective(line)
+				switch name {
+				case "title", "t":
+					s.title = value
+				case "subtitle", "st", "artist", "composer", "lyricist":
+					if value != "" {
+						s.authors = append(s.authors, value)
+					}
+				case "start_of_chorus", "soc":
+					flush()
+					inChorus = true
+				case "end_of_chorus", "eoc":
+					flush()
+					inChorus = false
+				case "chorus":
+					flush()
+					if lastChorus != "" {
+						s.verses = append(s.verses, lastChorus)
+					}
+				case "start_of_verse", "sov", "end_of_verse", "eov":
+					flush()
+				}
+				continue
+			}
+			line = strings.TrimSpace(chordPattern.ReplaceAllString(line, ""))
+			line = strings.Join(strings.Fields(line), " ")
+		}
+		if line == "" {
+			flush()
+			continue
+		}
+		paragraph = append(paragraph, line)
+	}
+	flush()
+	return s, nil
+}
+
+// parseParagraph removes the label and the repeat marker of a paragraph. Paragraphs inside a
+// ChordPro chorus are labeled chorus.
+func parseParagraph(lines []string, inChorus bool) (string, string, int) {
+	label := ""
+	repeat := 1
+	if len(lines) > 0 {
+		if m := labelPattern.FindStringSubmatch(lines[0]); m != nil {
+			label = strings.ToLower(strings.Join(strings.Fields(m[1]), " "))
+			lines = lines[1:]
+		}
+	}
+	if len(lines) > 0 {
+		if m := repeatPattern.FindStringSubmatch(lines[len(lines)-1]); m != nil {
+			repeat = 2
+			if n, err := strconv.Atoi(m[1] + m[2]); err == nil && n > 0 {
+				repeat = n
+			}
+			lines = lines[:len(lines)-1]
+		}
+	}
+	if inChorus {
+		// The chorus of a ChordPro file is the chorus whatever its own label
+		label = "chorus"
+	}
+	return strings.Join(lines, "\n"), label, repeat
+}
+
+// chordProDirective splits a directive such as {title: Amazing Grace}
+func chordProDirective(line string) (string, string) {
+	line = strings.TrimSuffix(strings.TrimPrefix(line, "{"), "}")
+	parts := strings.SplitN(line, ":", 2)
+	name := strings.ToLower(strings.TrimSpace(parts[0]))
+	if len(parts) == 1 {
+		return name, ""
+	}
+	return name, strings.TrimSpace(parts[1])
+}
+
+// importHymn replaces the verses of a hymn that only refers to a song of the library
+func importHymn(library songLibrary, verses []string, titlePage bool) ([]string, error) {
+	var filled []string
+	for _, v := range verses {
+		if strings.TrimSpace(v) != "" {
+			filled = append(filled, v)
+		}
+	}
+	if len(filled) != 1 || !hymnReference.MatchString(strings.TrimSpace(filled[0])) {
+		return verses, nil
+	}
+	s, ok := library.find(filled[0])
+	if !ok {
+		return verses, fmt.Errorf("no lyrics found for %q", filled[0])
+	}
+	return s.pages(titlePage), nil
+}
+
+// readOpenLyrics reads an OpenLyrics XML song, as exported by OpenLP. The verses are put in
+// the order of verseOrder, so a chorus listed several times is shown each time.
+func readOpenLyrics(path string) (*song, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromFile(path); err != nil {
+		return nil, err
+	}
+	root := doc.SelectElement("song")
+	if root == nil {
+		return nil, fmt.Errorf("not an OpenLyrics song")
+	}
+
+	s := new(song)
+	if title := root.FindElement("./properties/titles/title"); title != nil {
+		s.title = strings.TrimSpace(title.Text())
+	}
+	for _, author := range root.FindElements("./properties/authors/author") {
+		if name := strings.TrimSpace(author.Text()); name != "" {
+			s.authors = append(s.authors, name)
+		}
+	}
+	if songbook := root.FindElement("./properties/songbooks/songbook"); songbook != nil {
+		s.number = songbook.SelectAttrValue("entry", "")
+	}
+
+	// The verses by name. With several languages the first one is used.
+	byName := make(map[string]string)
+	var names []string
+	for _, verse := range root.FindElements("./lyrics/verse") {
+		name := strings.ToLower(verse.SelectAttrValue("name", ""))
+		if _, ok := byName[name]; ok {
+			continue
+		}
+		var blocks []string
+		for _, lines := range verse.SelectElements("lines") {
+			if text := strings.TrimSpace(openLyricsText(lines)); text != "" {
+				blocks = append(blocks, text)
+			}
+		}
+		byName[name] = strings.Join(blocks, "\n")
+		names = append(names, name)
+	}
+
+	order := names
+	if verseOrder := root.FindElement("./properties/verseOrder"); verseOrder != nil {
+		if fields := strings.Fields(strings.ToLower(verseOrder.Text())); len(fields) > 0 {
+			order = fields
+		}
+	}
+	for _, name := range order {
+		text, ok := byName[name]
+		if !ok {
+			// verseOrder may leave out the number of a single verse, ex: c for c1
+			text, ok = byName[name+"1"]
+		}
+		if !ok {
+			return nil, fmt.Errorf("verseOrder refers to the missing verse %q", name)
+		}
+		if text != "" {
+			s.verses = append(s.verses, text)
+		}
+	}
+	return s, nil
+}
+
+// openLyricsText returns the text of a lines element. <br/> is a new line; chords and
+// comments are left out.
+func openLyricsText(e *etree.Element) string {
+	var text strings.Builder
+	for _, token := range e.Child {
+		switch t := token.(type) {
+		case *etree.CharData:
+			// Line breaks in the XML itself are only formatting
+			text.WriteString(whitespace.ReplaceAllString(t.Data, " "))
+		case *etree.Element:
+			switch t.Tag {
+			case "br":
+				text.WriteString("\n")
+			case "comment":
+			default:
+				text.WriteString(openLyricsText(t))
+			}
+		}
+	}
+	lines := strings.Split(text.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.Join(lines, "\n")
+}
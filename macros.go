@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"github.com/360EntSecGroup-Skylar/excelize/v2"
+	"strings"
+)
+
+type macro struct {
+	name   string
+	params []string
+	body   *script
+}
+
+// loadMacros reads the Macros sheet, one macro per row
+func loadMacros(wb *excelize.File, conf config) {
+	rows, _ := wb.GetRows("Macros")
+	for idx, row := range rows {
+		if idx == 0 || len(row) < 3 || row[0] == "" {
+			continue
+		}
+
+		m := new(macro)
+		m.name = row[0]
+		for _, param := range strings.Split(row[1], ",") {
+			param = strings.TrimPrefix(strings.TrimSpace(param), "$")
+			if param != "" {
+				m.params = append(m.params, param)
+			}
+		}
+
+		var err error
+		m.body, err = parseScript(row[2])
+		if err != nil {
+			fmt.Println("Error in macro", m.name, err)
+			continue
+		}
+		conf.macro[strings.ToLower(m.name)] = m
+	}
+}
+
+// macroCall returns the macro name and arguments of a "macro Name arg1 arg2" command
+func macroCall(action string) (string, []string, bool) {
+	args := splitArgs(action)
+	if len(args) < 2 || args[0] != "macro" {
+		return "", nil, false
+	}
+	return strings.ToLower(args[1]), args[2:], true
+}
+
+// splitArgs splits a command into words. Double quotes group words, ex: macro Intro "Lyrics 2"
+func splitArgs(text string) []string {
+	var args []string
+	var current strings.Builder
+	inQuotes := false
+	started := false
+	for _, c := range text {
+		switch {
+		case c == '"':
+			inQuotes = !inQuotes
+			started = true
+		case c == ' ' && !inQuotes:
+			if started {
+				args = append(args, current.String())
+				current.Reset()
+				started = false
+			}
+		default:
+			current.WriteRune(c)
+			started = true
+		}
+	}
+	if started {
+		args = append(args, current.String())
+	}
+	return args
+}
+
+// runMacro runs a macro with its parameters bound to the arguments
+func runMacro(env *actionEnv, name string, args []string) {
+	m, ok := env.conf.macro[name]
+	if !ok {
+		debug("Unknown macro:", name)
+		return
+	}
+	if m.body == nil {
+		return
+	}
+
+	macroEnv := *env
+	macroEnv.args = make(map[string]string)
+	for i, param := range m.params {
+		if i < len(args) {
+			macroEnv.args[param] = args[i]
+		}
+	}
+	debug("Running macro", m.name, args)
+	execBlock(m.body.stmts, &macroEnv)
+}
+
+// checkMacros reports calls to unknown macros, calls with the wrong number of arguments and
+// recursive macros once the whole configuration is loaded
+func checkMacros(conf config) {
+	// Detect recursion with a depth first search through the macro calls
+	const (
+		visiting = iota + 1
+		done
+	)
+	status := make(map[string]int)
+	async := make(map[string]bool)
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		m := conf.macro[name]
+		switch status[name] {
+		case visiting:
+			for i, caller := range path {
+				if caller == name {
+					return macroCycle(append(path[i:len(path):len(path)], name))
+				}
+			}
+		case done:
+			return nil
+		}
+		status[name] = visiting
+		async[name] = m.body != nil && m.body.async
+
+		var err error
+		if m.body != nil {
+			err = walkScript(m.body.stmts, func(stmt actionStmt) error {
+				callee, ok := calledMacro(stmt)
+				if !ok {
+					return nil
+				}
+				if _, ok := conf.macro[callee]; !ok {
+					return nil
+				}
+				if err := visit(callee, append(path, name)); err != nil {
+					return err
+				}
+				async[name] = async[name] || async[callee]
+				return nil
+			})
+		}
+		if err != nil {
+			// Walk the macro again once the cycle below it is disabled
+			delete(status, name)
+			return err
+		}
+		status[name] = done
+		return nil
+	}
+
+	for name := range conf.macro {
+		for {
+			err := visit(name, nil)
+			cycle, ok := err.(macroCycle)
+			if !ok {
+				break
+			}
+			var names []string
+			for _, key := range cycle {
+				names = append(names, conf.macro[key].name)
+			}
+			fmt.Println("Error in macro", names[0]+":", "macro calls itself:", strings.Join(names, " -> "))
+			// Disable every macro of the cycle so that a button press can't hang the program
+			for _, key := range cycle {
+				conf.macro[key].body = nil
+			}
+		}
+	}
+	for name, m := range conf.macro {
+		if m.body != nil && async[name] {
+			m.body.async = true
+		}
+	}
+
+	check := func(where string, s *script) {
+		if s == nil {
+			return
+		}
+		err := walkScript(s.stmts, func(stmt actionStmt) error {
+			cmd, ok := stmt.(*commandStmt)
+			if !ok {
+				return nil
+			}
+			name, args, ok := macroCall(cmd.text)
+			if !ok {
+				return nil
+			}
+			m, ok := conf.macro[name]
+			if !ok {
+				return fmt.Errorf("unknown macro %q", name)
+			}
+			if len(args) != len(m.params) {
+				return fmt.Errorf("macro %s expects %d arguments, got %d", m.name, len(m.params), len(args))
+			}
+			if async[name] {
+				s.async = true
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Println("Error in", where+":", err)
+		}
+	}
+
+	for _, m := range conf.macro {
+		check("macro "+m.name, m.body)
+	}
+	for button, sc := range conf.shortcut {
+		check(fmt.Sprintf("Shortcuts, button %d pressed", button), sc.actionsPressed)
+		check(fmt.Sprintf("Shortcuts, button %d released", button), sc.actionsReleased)
+	}
+	check("Settings, Countdown Actions", serviceCountdown.actions)
+	for _, c := range conf.cues {
+		check("Run of Show, cue "+c.name, c.actions)
+	}
+	for _, e := range conf.schedule {
+		check("Schedule, "+e.name, e.actions)
+	}
+	for trigger, activators := range conf.activator {
+		for _, act := range activators {
+			check("Activators, "+trigger+" input "+act.input+" Action On", act.onAction)
+			check("Activators, "+trigger+" input "+act.input+" Action Off", act.offAction)
+		}
+	}
+}
+
+// macroCycle is the chain of macro calls that leads back to its first macro
+type macroCycle []string
+
+func (c macroCycle) Error() string {
+	return "macro calls itself: " + strings.Join(c, " -> ")
+}
+
+// calledMacro returns the name of the macro a statement calls, if any
+func calledMacro(stmt actionStmt) (string, bool) {
+	cmd, ok := stmt.(*commandStmt)
+	if !ok {
+		return "", false
+	}
+	name, _, ok := macroCall(cmd.text)
+	return name, ok
+}
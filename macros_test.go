@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCheckMacrosRecursion(t *testing.T) {
+	tests := []struct {
+		name     string
+		macros   map[string]string
+		disabled []string
+		kept     []string
+	}{
+		{"self recursion", map[string]string{"a": "macro a"}, []string{"a"}, nil},
+		{"caller of a self recursive macro", map[string]string{"a": "macro b", "b": "Cut\nmacro b"}, []string{"b"}, []string{"a"}},
+		{"indirect recursion", map[string]string{"a": "macro b", "b": "macro c", "c": "macro b"}, []string{"b", "c"}, []string{"a"}},
+		{"mutual recursion", map[string]string{"a": "macro b", "b": "macro a", "c": "macro a"}, []string{"a", "b"}, []string{"c"}},
+		{"shared callee", map[string]string{"a": "macro c\nmacro b", "b": "macro c", "c": "Cut"}, nil, []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		conf := config{macro: make(map[string]*macro)}
+		for name, source := range tt.macros {
+			body, err := parseScript(source)
+			if err != nil {
+				t.Fatalf("%s: macro %s: %v", tt.name, name, err)
+			}
+			conf.macro[name] = &macro{name: name, body: body}
+		}
+		checkMacros(conf)
+		for _, name := range tt.disabled {
+			if conf.macro[name].body != nil {
+				t.Errorf("%s: macro %s should be disabled", tt.name, name)
+			}
+		}
+		for _, name := range tt.kept {
+			if conf.macro[name].body == nil {
+				t.Errorf("%s: macro %s should be kept", tt.name, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// audioBuses are the vMix audio buses a microphone can be routed to. M is the master bus.
+var audioBuses = []string{"M", "A", "B", "C", "D", "E", "F", "G"}
+
+type micSetting struct {
+	mic    string
+	buses  []string
+	volume int
+}
+
+type micScene struct {
+	name     string
+	button   int
+	fade     int
+	settings map[string]micSetting
+}
+
+// loadMicScenes reads the microphone scenes from column J onwards of the microphones sheet
+func loadMicScenes(micCols [][]string, conf config) {
+	for idx, col := range micCols {
+		if idx < 9 || len(col) < 3 || col[0] == "" {
+			continue
+		}
+
+		scene := new(micScene)
+		scene.name = col[0]
+		scene.fade, _ = strconv.Atoi(col[1])
+		scene.button, _ = strconv.Atoi(col[2])
+		scene.settings = make(map[string]micSetting)
+
+		for _, cell := range col[3:] {
+			if cell == "" {
+				continue
+			}
+			setting, err := parseMicSetting(cell)
+			if err != nil {
+				fmt.Println("Error in mic scene", scene.name+":", err)
+				continue
+			}
+			if _, ok := conf.mics[setting.mic]; !ok {
+				fmt.Println("Error in mic scene", scene.name+": unknown microphone", setting.mic)
+				continue
+			}
+			scene.settings[setting.mic] = setting
+		}
+
+		conf.micScene[strings.ToLower(scene.name)] = scene
+	}
+}
+
+// parseMicSetting parses a single microphone entry of a scene.
+// syntax: mic_name: buses [volume]  or  mic_name: off
+func parseMicSetting(cell string) (micSetting, error) {
+	setting := micSetting{volume: 100}
+
+	parts := strings.SplitN(cell, ":", 2)
+	if len(parts) != 2 {
+		return setting, fmt.Errorf("expected 'mic: buses volume', got %q", cell)
+	}
+	setting.mic = strings.TrimSpace(parts[0])
+
+	fields := strings.Fields(parts[1])
+	if len(fields) == 0 || strings.ToLower(fields[0]) == "off" {
+		setting.volume = 0
+		return setting, nil
+	}
+
+	for _, bus := range strings.Split(fields[0], ",") {
+		bus = strings.ToUpper(strings.TrimSpace(bus))
+		if !containsBus(audioBuses, bus) {
+			return setting, fmt.Errorf("unknown audio bus %q for %s", bus, setting.mic)
+		}
+		setting.buses = append(setting.buses, bus)
+	}
+
+	if len(fields) > 1 {
+		volume, err := strconv.Atoi(fields[1])
+		if err != nil || volume < 0 || volume > 100 {
+			return setting, fmt.Errorf("volume for %s must be 0-100, got %q", setting.mic, fields[1])
+		}
+		setting.volume = volume
+	}
+
+	return setting, nil
+}
+
+func micSceneForButton(conf config, button int) *micScene {
+	for _, scene := range conf.micScene {
+		if scene.button == button {
+			return scene
+		}
+	}
+	return nil
+}
+
+// recallMicScene routes every microphone to the buses defined in the scene and crossfades the
+// volumes over the scene's fade time. Microphones that are not part of the scene (or are set
+// to off) are faded down and muted once the fade completes.
+func recallMicScene(client *vmixClient, scene *micScene, conf config, midiOutChan chan apcLEDS) {
+	debug("Recalling mic scene", scene.name)
+	var muted []string
+
+	for name, input := range conf.mics {
+		if name == "" || input == "" {
+			continue
+		}
+		in := url.QueryEscape(input)
+		setting, ok := scene.settings[name]
+
+		if !ok || len(setting.buses) == 0 {
+			_ = SendMessage(client, "FUNCTION SetVolumeFade Input="+in+"&Value=0,"+strconv.Itoa(scene.fade))
+			muted = append(muted, in)
+			continue
+		}
+
+		for _, bus := range audioBuses {
+			if containsBus(setting.buses, bus) {
+				_ = SendMessage(client, "FUNCTION AudioBusOn Value="+bus+"&Input="+in)
+			} else {
+				_ = SendMessage(client, "FUNCTION AudioBusOff Value="+bus+"&Input="+in)
+			}
+		}
+		_ = SendMessage(client, "FUNCTION AudioOn Input="+in)
+		_ = SendMessage(client, "FUNCTION SetVolumeFade Input="+in+"&Value="+
+			strconv.Itoa(setting.volume)+","+strconv.Itoa(scene.fade))
+	}
+
+	if len(muted) > 0 {
+		go func() {
+			time.Sleep(time.Duration(scene.fade) * time.Millisecond)
+			for _, in := range muted {
+				_ = SendMessage(client, "FUNCTION AudioOff Input="+in)
+			}
+		}()
+	}
+
+	showMicScene(scene, conf, midiOutChan)
+}
+
+// showMicScene lights the button of the active scene and returns the buttons of the other
+// scenes to their initial color.
+func showMicScene(active *micScene, conf config, midiOutChan chan apcLEDS) {
+	for _, scene := range conf.micScene {
+		if scene.button != 0 && scene != active {
+			restoreLED(scene.button, conf, midiOutChan)
+		}
+	}
+
+	if active.button != 0 {
+		midiOutChan <- apcLEDS{
+			buttons: []int{active.button},
+			color:   "green",
+		}
+	}
+}
+
+func containsBus(buses []string, bus string) bool {
+	for _, b := range buses {
+		if b == bus {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"github.com/360EntSecGroup-Skylar/excelize/v2"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// overlay is how a title is shown: its overlay channel, the vMix functions that bring it in and
+// take it out, and the textboxes its text goes in
+type overlay struct {
+	channel   int
+	show      string
+	hide      string
+	textboxes []string
+}
+
+// defaultOverlay is used when the Overlays sheet doesn't list the content
+var defaultOverlay = &overlay{channel: 1, show: "In", hide: "Out"}
+
+// overlayContent are the kinds of content the Overlays sheet can set
+var overlayContent = []string{"prayers", "pop", "hymns", "responses", "readings", "speakers", "cues"}
+
+// loadOverlays reads the Overlays sheet, one kind of content or item per row
+func loadOverlays(wb *excelize.File, conf config, vmixState *state) {
+	rows, _ := wb.GetRows("Overlays")
+	for idx, row := range rows {
+		if idx == 0 || len(row) == 0 || row[0] == "" {
+			continue
+		}
+		for len(row) < 5 {
+			row = append(row, "")
+		}
+
+		content := strings.ToLower(strings.TrimSpace(row[0]))
+		if !containsKeyword(overlayContent, content) {
+			if _, err := strconv.Atoi(content); err != nil {
+				fmt.Println("Error in Overlays,", row[0]+": unknown content")
+				continue
+			}
+		}
+
+		ov := &overlay{channel: 1, show: "In", hide: "Out"}
+		var err error
+		if row[1] != "" {
+			ov.channel, err = strconv.Atoi(row[1])
+			if err == nil && (ov.channel < 1 || ov.channel > 4) {
+				err = fmt.Errorf("channel must be 1 to 4")
+			}
+		}
+		if err == nil && row[2] != "" {
+			ov.show, err = overlayFunction(row[2], "In", "Zoom")
+		}
+		if err == nil && row[3] != "" {
+			ov.hide, err = overlayFunction(row[3], "Out", "Off", "Zoom")
+		}
+		if err != nil {
+			fmt.Println("Error in Overlays,", row[0]+":", err)
+			continue
+		}
+		for _, tb := range strings.Split(row[4], ",") {
+			if tb = strings.TrimSpace(tb); tb != "" {
+				ov.textboxes = append(ov.textboxes, tb)
+			}
+		}
+		conf.overlay[content] = ov
+	}
+}
+
+// overlayFunction checks a Show or Hide cell and returns it as it is written in vMix functions
+func overlayFunction(value string, allowed ...string) (string, error) {
+	for _, a := range allowed {
+		if strings.EqualFold(strings.TrimSpace(value), a) {
+			return a, nil
+		}
+	}
+	return "", fmt.Errorf("%q must be one of %s", value, strings.Join(allowed, ", "))
+}
+
+// itemOverlay returns the overlay of an item, from its button or else its kind of content. The
+// textboxes the title doesn't have are left out.
+func itemOverlay(conf config, vmixState *state, content string, button int, input string) *overlay {
+	ov, ok := conf.overlay[strconv.Itoa(button)]
+	if !ok {
+		ov, ok = conf.overlay[content]
+	}
+	if !ok {
+		return defaultOverlay
+	}
+
+	fields, known := vmixState.titleFields[input]
+	if !known {
+		return ov
+	}
+	// The item gets its own copy without the textboxes its title doesn't have
+	valid := *ov
+	valid.textboxes = nil
+	for _, tb := range ov.textboxes {
+		if !containsKeyword(fields, tb) {
+			fmt.Println("Error in Overlays,", content, "button", strconv.Itoa(button)+":", input, "has no textbox",
+				tb+". It has", strings.Join(fields, ", "))
+			continue
+		}
+		valid.textboxes = append(valid.textboxes, tb)
+	}
+	return &valid
+}
+
+// applyOverlays sets the overlay of every item once the Overlays sheet and the items are loaded
+func applyOverlays(conf config, vmixState *state) {
+	for button, item := range conf.prayer {
+		item.overlay = itemOverlay(conf, vmixState, "prayers", button, item.input)
+	}
+	for button, item := range conf.pop {
+		item.overlay = itemOverlay(conf, vmixState, "pop", button, item.input)
+	}
+	for button, item := range conf.hymn {
+		item.overlay = itemOverlay(conf, vmixState, "hymns", button, item.input)
+	}
+	for button, item := range conf.response {
+		item.overlay = itemOverlay(conf, vmixState, "responses", button, item.input)
+	}
+	for button, item := range conf.reading {
+		item.overlay = itemOverlay(conf, vmixState, "readings", button, item.input)
+	}
+	for button, item := range conf.speaker {
+		item.overlay = itemOverlay(conf, vmixState, "speakers", button, item.input)
+	}
+
+	// A Second Title on the channel of its item would replace the item
+	check := func(content string, button int, input string, ov *overlay) {
+		lang, ok := conf.language[strings.ToLower(input)]
+		if ok && lang.title != "" && lang.overlay == ov.channel {
+			fmt.Println("Error in Second Language,", input+": Overlay", lang.overlay, "is the overlay channel of",
+				content, "button", button)
+			delete(conf.language, strings.ToLower(input))
+		}
+	}
+	for button, item := range conf.prayer {
+		check("prayers", button, item.input, item.overlay)
+	}
+	for button, item := range conf.pop {
+		check("pop", button, item.input, item.overlay)
+	}
+	for button, item := range conf.hymn {
+		check("hymns", button, item.input, item.overlay)
+	}
+	for button, item := range conf.response {
+		check("responses", button, item.input, item.overlay)
+	}
+}
+
+// setText puts text in the textboxes of an overlay. tbName, the first textbox of the title, is
+// used when the overlay doesn't list any.
+func (ov *overlay) setText(texts map[string]string, tbName string, text string) {
+	if ov == nil {
+		ov = defaultOverlay
+	}
+	if len(ov.textboxes) == 0 {
+		if tbName == "" {
+			tbName = "TextBlock1.Text"
+		}
+		texts[tbName] = text
+		return
+	}
+	for _, tb := range ov.textboxes {
+		texts[tb] = text
+	}
+}
+
+// showFunction returns the vMix function that brings a title in on the overlay channel
+func (ov *overlay) showFunction(input string) string {
+	if ov == nil {
+		ov = defaultOverlay
+	}
+	return "FUNCTION OverlayInput" + strconv.Itoa(ov.channel) + ov.show + " Input=" + url.QueryEscape(input)
+}
+
+// channelNumber returns the overlay channel of a title
+func (ov *overlay) channelNumber() int {
+	if ov == nil {
+		ov = defaultOverlay
+	}
+	return ov.channel
+}
+
+// hideFunction returns the vMix function that takes the overlay channel out
+func (ov *overlay) hideFunction() string {
+	if ov == nil {
+		ov = defaultOverlay
+	}
+	return "FUNCTION OverlayInput" + strconv.Itoa(ov.channel) + ov.hide
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultPanicHold is how long the panic button has to be held to restore the saved state
+const defaultPanicHold = 1500 * time.Millisecond
+
+type panicState struct {
+	lock    sync.Mutex
+	active  bool
+	saved   *snapshot
+	pressed time.Time
+}
+
+var panicked = new(panicState)
+
+// panicButton returns the button configured as "Panic Button" in the Settings sheet, or 0
+func panicButton(conf config) int {
+	button, _ := strconv.Atoi(conf.misc["Panic Button"])
+	return button
+}
+
+// panicPress handles a press of the panic button. The first press saves the current state and
+// cuts to the slate; while panicked, the press is timed so that a long press restores.
+func panicPress(client *vmixClient, conf config, vmixState *state, midiOutChan chan apcLEDS) {
+	panicked.lock.Lock()
+	defer panicked.lock.Unlock()
+
+	if panicked.active {
+		panicked.pressed = time.Now()
+		return
+	}
+
+	debug("Panic! Cutting to the slate")
+	panicked.saved = takeSnapshot(vmixState, conf)
+	panicked.active = true
+	panicked.pressed = time.Time{}
+
+	if slate := conf.misc["Panic Slate"]; slate != "" {
+		_ = SendMessage(client, "FUNCTION CutDirect Input="+url.QueryEscape(slate))
+	}
+
+	keep := conf.misc["Panic Mic"]
+	for name, input := range conf.mics {
+		if name == "" || input == "" {
+			continue
+		}
+		if name == keep {
+			_ = SendMessage(client, "FUNCTION AudioOn Input="+url.QueryEscape(input))
+		} else {
+			_ = SendMessage(client, "FUNCTION AudioOff Input="+url.QueryEscape(input))
+		}
+	}
+
+	for channel := 1; channel <= 4; channel++ {
+		_ = SendMessage(client, "FUNCTION OverlayInput"+strconv.Itoa(channel)+"Off")
+	}
+
+	// Stop verse paging and forget the speaker on air
+	stopVerses()
+	hideSpeaker(client, conf, midiOutChan)
+	clearVerseProgress(conf, midiOutChan)
+
+	midiOutChan <- apcLEDS{
+		buttons: []int{panicButton(conf)},
+		color:   "redBlink",
+	}
+}
+
+// panicRelease restores the state saved by the panic button when it was held long enough
+func panicRelease(client *vmixClient, conf config, vmixState *state, midiOutChan chan apcLEDS) {
+	panicked.lock.Lock()
+	defer panicked.lock.Unlock()
+
+	if !panicked.active || panicked.pressed.IsZero() {
+		return
+	}
+
+	hold := defaultPanicHold
+	if ms, err := strconv.Atoi(conf.misc["Panic Restore Hold"]); err == nil {
+		hold = time.Duration(ms) * time.Millisecond
+	}
+	held := time.Since(panicked.pressed)
+	panicked.pressed = time.Time{}
+	if held < hold {
+		debug("Panic button released after", held, "- hold it for", hold, "to restore")
+		return
+	}
+
+	debug("Restoring state saved by the panic button")
+	restoreSnapshot(client, panicked.saved, conf, vmixState)
+	panicked.active = false
+	panicked.saved = nil
+	restoreLED(panicButton(conf), conf, midiOutChan)
+}
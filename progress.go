@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// progressPress is the button of the row whose press jumped to a verse, so its release is
+// ignored
+var progressPress = struct {
+	lock   sync.Mutex
+	button int
+}{}
+
+// progressButtons returns the buttons of the progress row, nil when there is none
+func progressButtons(conf config) []int {
+	setting := strings.ToLower(strings.TrimSpace(conf.misc["Verse Progress Row"]))
+	first := 65
+	if setting != "round" {
+		row, err := strconv.Atoi(setting)
+		if err != nil || row < 1 || row > 8 {
+			return nil
+		}
+		first = (row-1)*8 + 1
+	}
+	buttons := make([]int, 8)
+	for i := range buttons {
+		buttons[i] = first + i
+	}
+	return buttons
+}
+
+// progressLED returns the button of the row that stands for a verse
+func progressLED(verse, total, leds int) int {
+	if total <= leds {
+		return verse
+	}
+	return verse * leds / total
+}
+
+// progressVerse returns the first verse a button of the row stands for
+func progressVerse(led, total, leds int) int {
+	if total <= leds {
+		return led
+	}
+	return (led*total + leds - 1) / leds
+}
+
+// showVerseProgress lights the progress row for a verse
+func showVerseProgress(conf config, midiOutChan chan apcLEDS, index, total int) {
+	buttons := progressButtons(conf)
+	if buttons == nil || index < 0 || index >= total {
+		return
+	}
+	round := buttons[0] == 65
+
+	current := progressLED(index, total, len(buttons))
+	used := progressLED(total-1, total, len(buttons)) + 1
+	colors := make(map[string][]int)
+	for i, button := range buttons {
+		color := "off"
+		switch {
+		case i <= current && index == total-1:
+			color = "greenBlink"
+		case i <= current:
+			color = "green"
+		case i < used && !round:
+			color = "yellow"
+		}
+		colors[color] = append(colors[color], button)
+	}
+	for color, buttons := range colors {
+		midiOutChan <- apcLEDS{
+			buttons: buttons,
+			color:   color,
+		}
+	}
+}
+
+// clearVerseProgress puts the progress row back to its initial colors
+func clearVerseProgress(conf config, midiOutChan chan apcLEDS) {
+	for _, button := range progressButtons(conf) {
+		restoreLED(button, conf, midiOutChan)
+	}
+}
+
+// verseProgressButton jumps to the verse of a button of the progress row. It returns false when
+// no verses are shown or the button isn't in the row.
+func verseProgressButton(conf config, verseChan chan verses, button int) bool {
+	item, ok := activeVerses()
+	if !ok {
+		return false
+	}
+	buttons := progressButtons(conf)
+	for i, b := range buttons {
+		if b == button {
+			progressPress.lock.Lock()
+			progressPress.button = button
+			progressPress.lock.Unlock()
+			showVerse(progressVerse(i, len(item.verses), len(buttons)), verseChan)
+			return true
+		}
+	}
+	return false
+}
+
+// progressRelease returns false for the release of a press that jumped to a verse
+func progressRelease(button int) bool {
+	progressPress.lock.Lock()
+	defer progressPress.lock.Unlock()
+	if progressPress.button == button {
+		progressPress.button = 0
+		return false
+	}
+	return true
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"github.com/360EntSecGroup-Skylar/excelize/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type scheduleEntry struct {
+	name    string
+	anyDay  bool
+	day     time.Weekday
+	clock   time.Duration
+	delay   time.Duration
+	cond    condExpr
+	actions *script
+	button  int
+
+	// guarded by scheduleLock
+	held bool
+	due  time.Time
+}
+
+// scheduleLock guards the due times of the schedule, which are changed by the scheduler and by
+// cancel from buttons or scripts.
+var scheduleLock sync.Mutex
+
+// loadSchedule reads the Schedule sheet, one scheduled action per row
+func loadSchedule(wb *excelize.File, conf config) {
+	rows, _ := wb.GetRows("Schedule")
+	for idx, row := range rows {
+		if idx == 0 || len(row) < 3 || row[0] == "" {
+			continue
+		}
+
+		e := new(scheduleEntry)
+		e.name = row[0]
+		err := parseScheduleTime(e, strings.TrimSpace(row[1]))
+		if err == nil {
+			e.actions, err = parseScript(row[2])
+		}
+		if err != nil {
+			fmt.Println("Error in Schedule,", e.name+":", err)
+			continue
+		}
+		if len(row) > 3 {
+			e.button, _ = strconv.Atoi(row[3])
+		}
+		conf.schedule[strings.ToLower(e.name)] = e
+	}
+}
+
+func parseScheduleTime(e *scheduleEntry, when string) error {
+	if delay, condText := splitOn(when, "after"); condText != "" {
+		d, err := parseWait(delay)
+		if err != nil {
+			return fmt.Errorf("expected 'delay after condition', ex: 30s after Input=Postlude")
+		}
+		e.delay = d
+		e.cond, err = parseCondition(condText)
+		return err
+	}
+
+	e.anyDay = true
+	fields := strings.Fields(when)
+	if len(fields) == 2 {
+		day, ok := weekday(fields[0])
+		if !ok {
+			return fmt.Errorf("unknown day %q", fields[0])
+		}
+		e.anyDay = false
+		e.day = day
+		fields = fields[1:]
+	}
+	if len(fields) != 1 {
+		return fmt.Errorf("expected a time such as 9:55 or Sun 9:55")
+	}
+
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if t, err := time.Parse(layout, fields[0]); err == nil {
+			e.clock = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+				time.Duration(t.Second())*time.Second
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid time %q", fields[0])
+}
+
+// weekday recognizes day names and their first three letters, ex: Sun, sunday
+func weekday(name string) (time.Weekday, bool) {
+	name = strings.ToLower(name)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		full := strings.ToLower(day.String())
+		if name == full || name == full[:3] {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// nextRun returns the first time after t at which a time of day entry runs
+func (e *scheduleEntry) nextRun(t time.Time) time.Time {
+	// Built from the date rather than added to midnight so that it is right on DST changes
+	hour := int(e.clock / time.Hour)
+	minute := int(e.clock % time.Hour / time.Minute)
+	second := int(e.clock % time.Minute / time.Second)
+	for days := 0; days <= 7; days++ {
+		run := time.Date(t.Year(), t.Month(), t.Day()+days, hour, minute, second, 0, t.Location())
+		if run.After(t) && (e.anyDay || run.Weekday() == e.day) {
+			return run
+		}
+	}
+	return time.Time{}
+}
+
+// runSchedule runs the scheduled actions when they are due. This is a blocking function.
+func runSchedule(client *vmixClient, conf config, vmixState *state, midiOutChan chan apcLEDS,
+	verseChan chan verses) {
+	if len(conf.schedule) == 0 {
+		return
+	}
+
+	scheduleLock.Lock()
+	for _, e := range conf.schedule {
+		if e.cond == nil {
+			e.due = e.nextRun(time.Now())
+			debug("Scheduled", e.name, "at", e.due.Format("Mon 15:04:05"))
+		}
+	}
+	scheduleLock.Unlock()
+
+	env := newActionEnv(client, conf, vmixState, midiOutChan, verseChan, 0)
+	blinking := make(map[int]bool)
+	events := subscribe(vmixState)
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-events:
+		case <-ticker.C:
+		}
+		now := time.Now()
+
+		var due []*scheduleEntry
+		soon := make(map[int]bool)
+		scheduleLock.Lock()
+		for _, e := range conf.schedule {
+			if e.cond != nil {
+				held := e.cond.eval(env)
+				if held && !e.held {
+					e.due = now.Add(e.delay)
+				} else if !held {
+					e.due = time.Time{}
+				}
+				e.held = held
+			}
+
+			if !e.due.IsZero() && !now.Before(e.due) {
+				due = append(due, e)
+				e.due = time.Time{}
+				if e.cond == nil {
+					e.due = e.nextRun(now)
+				}
+			}
+			if e.button != 0 && !e.due.IsZero() && e.due.Sub(now) <= time.Minute {
+				soon[e.button] = true
+			}
+		}
+		scheduleLock.Unlock()
+
+		for _, e := range due {
+			debug("Running scheduled action", e.name)
+			runScript(e.actions, newActionEnv(client, conf, vmixState, midiOutChan, verseChan, e.button))
+		}
+
+		// Blink the cancel buttons of the actions about to run
+		for _, e := range conf.schedule {
+			button := e.button
+			if button == 0 || blinking[button] == soon[button] {
+				continue
+			}
+			blinking[button] = soon[button]
+			if soon[button] {
+				midiOutChan <- apcLEDS{
+					buttons: []int{button},
+					color:   "yellowBlink",
+				}
+			} else {
+				restoreLED(button, conf, midiOutChan)
+			}
+		}
+	}
+}
+
+// cancelScheduled cancels the next run of the scheduled action with the given name, or of all
+// of them when name is empty. Time of day actions run again at their next time; delayed
+// actions when their condition becomes true again.
+func cancelScheduled(conf config, name string) {
+	scheduleLock.Lock()
+	defer scheduleLock.Unlock()
+
+	for key, e := range conf.schedule {
+		if (name != "" && key != strings.ToLower(name)) || e.due.IsZero() {
+			continue
+		}
+		debug("Cancelling scheduled action", e.name)
+		if e.cond == nil {
+			e.due = e.nextRun(e.due)
+		} else {
+			e.due = time.Time{}
+		}
+	}
+}
+
+// scheduleCancelButton cancels the scheduled actions that use the button as their cancel
+// button. It returns false when the button is not a cancel button.
+func scheduleCancelButton(conf config, button int) bool {
+	found := false
+	for _, e := range conf.schedule {
+		if e.button == button {
+			cancelScheduled(conf, e.name)
+			found = true
+		}
+	}
+	return found
+}
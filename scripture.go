@@ -0,0 +1,444 @@
+package main
+
+import (
+	"fmt"
+	"github.com/360EntSecGroup-Skylar/excelize/v2"
+	"github.com/beevik/etree"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type bibleBook struct {
+	name     string
+	osis     string
+	usfm     string
+	aliases  []string
+	chapters map[int]map[int]string
+}
+
+type bible struct {
+	books map[string]*bibleBook
+}
+
+type reading struct {
+	button    int
+	input     string
+	tbName    string
+	refTbName string
+	reference string
+	verses    []string
+	refs      []string
+	overlay   *overlay
+}
+
+// bibleBooks lists the books with their OSIS and USFM ids and other common abbreviations
+var bibleBooks = [][]string{
+	{"Genesis", "Gen", "GEN"}, {"Exodus", "Exod", "EXO"}, {"Leviticus", "Lev", "LEV"},
+	{"Numbers", "Num", "NUM"}, {"Deuteronomy", "Deut", "DEU"}, {"Joshua", "Josh", "JOS"},
+	{"Judges", "Judg", "JDG"}, {"Ruth", "Ruth", "RUT"}, {"1 Samuel", "1Sam", "1SA"},
+	{"2 Samuel", "2Sam", "2SA"}, {"1 Kings", "1Kgs", "1KI"}, {"2 Kings", "2Kgs", "2KI"},
+	{"1 Chronicles", "1Chr", "1CH"}, {"2 Chronicles", "2Chr", "2CH"}, {"Ezra", "Ezra", "EZR"},
+	{"Nehemiah", "Neh", "NEH"}, {"Esther", "Esth", "EST"}, {"Job", "Job", "JOB"},
+	{"Psalms", "Ps", "PSA", "Pss"}, {"Proverbs", "Prov", "PRO"}, {"Ecclesiastes", "Eccl", "ECC", "Qoh"},
+	{"Song of Songs", "Song", "SNG", "Song of Solomon", "Canticles"}, {"Isaiah", "Isa", "ISA"},
+	{"Jeremiah", "Jer", "JER"}, {"Lamentations", "Lam", "LAM"}, {"Ezekiel", "Ezek", "EZK"},
+	{"Daniel", "Dan", "DAN"}, {"Hosea", "Hos", "HOS"}, {"Joel", "Joel", "JOL"}, {"Amos", "Amos", "AMO"},
+	{"Obadiah", "Obad", "OBA"}, {"Jonah", "Jonah", "JON"}, {"Micah", "Mic", "MIC"},
+	{"Nahum", "Nah", "NAM"}, {"Habakkuk", "Hab", "HAB"}, {"Zephaniah", "Zeph", "ZEP"},
+	{"Haggai", "Hag", "HAG"}, {"Zechariah", "Zech", "ZEC"}, {"Malachi", "Mal", "MAL"},
+	{"Tobit", "Tob", "TOB"}, {"Judith", "Jdt", "JDT"}, {"Wisdom", "Wis", "WIS", "Wisdom of Solomon"},
+	{"Sirach", "Sir", "SIR", "Ecclesiasticus"}, {"Baruch", "Bar", "BAR"},
+	{"Matthew", "Matt", "MAT", "Mt"}, {"Mark", "Mark", "MRK", "Mk"}, {"Luke", "Luke", "LUK", "Lk"},
+	{"John", "John", "JHN", "Jn"}, {"Acts", "Acts", "ACT"}, {"Romans", "Rom", "ROM"},
+	{"1 Corinthians", "1Cor", "1CO"}, {"2 Corinthians", "2Cor", "2CO"}, {"Galatians", "Gal", "GAL"},
+	{"Ephesians", "Eph", "EPH"}, {"Philippians", "Phil", "PHP"}, {"Colossians", "Col", "COL"},
+	{"1 Thessalonians", "1Thess", "1TH"}, {"2 Thessalonians", "2Thess", "2TH"},
+	{"1 Timothy", "1Tim", "1TI"}, {"2 Timothy", "2Tim", "2TI"}, {"Titus", "Titus", "TIT"},
+	{"Philemon", "Phlm", "PHM"}, {"Hebrews", "Heb", "HEB"}, {"James", "Jas", "JAS"},
+	{"1 Peter", "1Pet", "1PE"}, {"2 Peter", "2Pet", "2PE"}, {"1 John", "1John", "1JN"},
+	{"2 John", "2John", "2JN"}, {"3 John", "3John", "3JN"}, {"Jude", "Jude", "JUD"},
+	{"Revelation", "Rev", "REV"},
+}
+
+var (
+	romanBook      = regexp.MustCompile(`^(iii|ii|i)\s+`)
+	referencePart  = regexp.MustCompile(`^\s*((?:[1-3]|iii|ii|i)?\s*[A-Za-z][A-Za-z. ]*?)?\s*(\d.*)$`)
+	usfmMarker     = regexp.MustCompile(`\\([a-z]+[0-9]*\*?)`)
+	usfmFootnote   = regexp.MustCompile(`(?s)\\(f|fe|x) .*?\\(f|fe|x)\*`)
+	usfmWord       = regexp.MustCompile(`\\(\+?w) ([^|\\]*)(\|[^\\]*)?\\(\+?w)\*`)
+	usfmSkipMarker = regexp.MustCompile(`^(id|ide|h|toc\d*|mt\d*|ms\d*|mr|s\d*|sr|r|d|rem|cl|sts|usfm)$`)
+)
+
+func newBible() *bible {
+	b := &bible{books: make(map[string]*bibleBook)}
+	for _, names := range bibleBooks {
+		b.books[names[1]] = &bibleBook{
+			name:     names[0],
+			osis:     names[1],
+			usfm:     names[2],
+			aliases:  names[3:],
+			chapters: make(map[int]map[int]string),
+		}
+	}
+	return b
+}
+
+// normalizeBookName makes "I Cor." and "1cor" compare equal
+func normalizeBookName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = romanBook.ReplaceAllStringFunc(name, func(s string) string {
+		return strconv.Itoa(len(strings.TrimSpace(s)))
+	})
+	return strings.NewReplacer(" ", "", ".", "").Replace(name)
+}
+
+// findBook returns the book for a name, an id or an abbreviation. Abbreviations have to be the
+// start of only one book name.
+func (b *bible) findBook(name string) (*bibleBook, error) {
+	key := normalizeBookName(name)
+	var candidates []*bibleBook
+	for _, names := range bibleBooks {
+		book := b.books[names[1]]
+		for _, n := range names {
+			if normalizeBookName(n) == key {
+				return book, nil
+			}
+		}
+		if len(key) >= 2 && strings.HasPrefix(normalizeBookName(names[0]), key) {
+			candidates = append(candidates, book)
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return nil, fmt.Errorf("unknown book %q", name)
+	case 1:
+		return candidates[0], nil
+	}
+	return nil, fmt.Errorf("%q could be %s or %s", name, candidates[0].name, candidates[1].name)
+}
+
+func (b *bible) bookByID(id string) *bibleBook {
+	for _, book := range b.books {
+		if strings.EqualFold(book.osis, id) || strings.EqualFold(book.usfm, id) {
+			return book
+		}
+	}
+	return nil
+}
+
+// addVerseText adds text to a verse. The spacing is cleaned up when the verse is looked up.
+func (book *bibleBook) addVerseText(chapter, verse int, text string) {
+	if book.chapters[chapter] == nil {
+		book.chapters[chapter] = make(map[int]string)
+	}
+	book.chapters[chapter][verse] += text
+}
+
+// loadBible reads an OSIS or USFM Bible. It returns nil when no Bible is configured.
+func loadBible(path string) *bible {
+	if path == "" {
+		return nil
+	}
+	b := newBible()
+	info, err := os.Stat(path)
+	if err == nil && info.IsDir() {
+		var files []os.DirEntry
+		files, err = os.ReadDir(path)
+		for _, f := range files {
+			switch strings.ToLower(filepath.Ext(f.Name())) {
+			case ".usfm", ".sfm":
+				if err := b.readUSFM(filepath.Join(path, f.Name())); err != nil {
+					fmt.Println("Error reading", f.Name()+":", err)
+				}
+			}
+		}
+	} else if err == nil {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".usfm", ".sfm":
+			err = b.readUSFM(path)
+		default:
+			err = b.readOSIS(path)
+		}
+	}
+	if err != nil {
+		fmt.Println("Error reading the Bible:", err)
+		return nil
+	}
+	return b
+}
+
+// readOSIS reads an OSIS XML Bible. Both verse containers and milestones (sID/eID) are
+// understood. Notes and headings are left out.
+func (b *bible) readOSIS(path string) error {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromFile(path); err != nil {
+		return err
+	}
+
+	var book *bibleBook
+	chapter, verse := 0, 0
+	var walk func(e *etree.Element)
+	walk = func(e *etree.Element) {
+		for _, token := range e.Child {
+			switch t := token.(type) {
+			case *etree.CharData:
+				if book != nil && verse != 0 {
+					book.addVerseText(chapter, verse, t.Data)
+				}
+			case *etree.Element:
+				switch t.Tag {
+				case "note", "title":
+					continue
+				case "verse":
+					if t.SelectAttr("eID") != nil {
+						verse = 0
+						continue
+					}
+					// A verse can have several ids, ex: osisID="John.3.16 John.3.17"
+					ids := strings.Fields(t.SelectAttrValue("osisID", t.SelectAttrValue("sID", "")))
+					if len(ids) == 0 {
+						continue
+					}
+					parts := strings.Split(ids[0], ".")
+					if len(parts) != 3 {
+						continue
+					}
+					book = b.bookByID(parts[0])
+					chapter, _ = strconv.Atoi(parts[1])
+					verse, _ = strconv.Atoi(parts[2])
+					if t.SelectAttr("sID") == nil && len(t.Child) > 0 {
+						// A verse container
+						walk(t)
+						verse = 0
+					}
+					continue
+				}
+				walk(t)
+			}
+		}
+	}
+	walk(&doc.Element)
+	return nil
+}
+
+// readUSFM reads one book in USFM. Footnotes, cross references and headings are left out.
+func (b *bible) readUSFM(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	text := usfmFootnote.ReplaceAllString(string(data), "")
+	text = usfmWord.ReplaceAllString(text, "$2")
+
+	var book *bibleBook
+	chapter, verse := 0, 0
+	markers := usfmMarker.FindAllStringSubmatchIndex(text, -1)
+	for i, m := range markers {
+		marker := text[m[2]:m[3]]
+		end := len(text)
+		if i+1 < len(markers) {
+			end = markers[i+1][0]
+		}
+		content := text[m[1]:end]
+
+		switch marker {
+		case "id":
+			fields := strings.Fields(content)
+			if len(fields) > 0 {
+				book = b.bookByID(fields[0])
+			}
+			continue
+		case "c":
+			chapter, _ = strconv.Atoi(strings.TrimSpace(content))
+			verse = 0
+			continue
+		case "v":
+			fields := strings.SplitN(strings.TrimSpace(content), " ", 2)
+			// Verse bridges such as 3-4 are kept as the first verse
+			verse, _ = strconv.Atoi(strings.Split(fields[0], "-")[0])
+			content = ""
+			if len(fields) > 1 {
+				content = fields[1]
+			}
+		}
+		if usfmSkipMarker.MatchString(marker) {
+			continue
+		}
+		if book != nil && chapter != 0 && verse != 0 {
+			book.addVerseText(chapter, verse, content)
+		}
+	}
+	if book == nil {
+		return fmt.Errorf("no \\id line")
+	}
+	return nil
+}
+
+// passage looks up a reference such as "John 3:16-21; Ps 23". It returns the text and the
+// reference of each verse.
+func (b *bible) passage(reference string) ([]string, []string, error) {
+	var texts, refs []string
+	var book *bibleBook
+	for _, part := range strings.Split(reference, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		m := referencePart.FindStringSubmatch(part)
+		if m == nil {
+			return nil, nil, fmt.Errorf("invalid reference %q", strings.TrimSpace(part))
+		}
+		if strings.TrimSpace(m[1]) != "" {
+			var err error
+			if book, err = b.findBook(m[1]); err != nil {
+				return nil, nil, err
+			}
+		}
+		if book == nil {
+			return nil, nil, fmt.Errorf("missing book in %q", strings.TrimSpace(part))
+		}
+
+		chapter := 0
+		for _, span := range strings.Split(m[2], ",") {
+			from, to, err := parseSpan(strings.TrimSpace(span), &chapter)
+			if err != nil {
+				return nil, nil, err
+			}
+			t, r := book.verses(from, to)
+			if len(t) == 0 {
+				return nil, nil, fmt.Errorf("%s %s is not in the Bible file", book.name, strings.TrimSpace(span))
+			}
+			texts = append(texts, t...)
+			refs = append(refs, r...)
+		}
+	}
+	if len(texts) == 0 {
+		return nil, nil, fmt.Errorf("empty reference")
+	}
+	return texts, refs, nil
+}
+
+// verseRef is a chapter and verse. Verse 0 is the start of the chapter, -1 its end.
+type verseRef struct {
+	chapter, verse int
+}
+
+// parseSpan parses one comma separated part of a reference: 3:16-21, 16, 23, 3:16-4:2 or
+// 23-24. A plain number is a verse once a chapter has been given, otherwise a chapter.
+func parseSpan(span string, chapter *int) (verseRef, verseRef, error) {
+	var refs []verseRef
+	for _, bound := range strings.SplitN(span, "-", 2) {
+		// Parts of verses such as 16a are shown whole
+		bound = strings.TrimRight(strings.TrimSpace(bound), "abc")
+		parts := strings.SplitN(bound, ":", 2)
+		numbers := make([]int, len(parts))
+		for i, p := range parts {
+			n, err := strconv.Atoi(strings.TrimSpace(p))
+			if err != nil {
+				return verseRef{}, verseRef{}, fmt.Errorf("invalid reference %q", span)
+			}
+			numbers[i] = n
+		}
+
+		switch {
+		case len(numbers) == 2:
+			*chapter = numbers[0]
+			refs = append(refs, verseRef{numbers[0], numbers[1]})
+		case *chapter != 0:
+			refs = append(refs, verseRef{*chapter, numbers[0]})
+		default:
+			refs = append(refs, verseRef{numbers[0], 0})
+		}
+	}
+
+	from, to := refs[0], refs[len(refs)-1]
+	if to.verse == 0 {
+		// To the end of the chapter
+		to.verse = -1
+	}
+	return from, to, nil
+}
+
+// verses returns the verses from one reference to another, in order
+func (book *bibleBook) verses(from, to verseRef) ([]string, []string) {
+	var texts, refs []string
+	for chapter := from.chapter; chapter <= to.chapter; chapter++ {
+		var numbers []int
+		for n := range book.chapters[chapter] {
+			numbers = append(numbers, n)
+		}
+		sort.Ints(numbers)
+		for _, n := range numbers {
+			if chapter == from.chapter && n < from.verse {
+				continue
+			}
+			if chapter == to.chapter && to.verse != -1 && n > to.verse {
+				continue
+			}
+			text := strings.Join(strings.Fields(book.chapters[chapter][n]), " ")
+			if text == "" {
+				continue
+			}
+			texts = append(texts, text)
+			refs = append(refs, fmt.Sprintf("%s %d:%d", book.name, chapter, n))
+		}
+	}
+	return texts, refs
+}
+
+// loadReadings reads the Readings sheet and looks up the passages in the Bible
+func loadReadings(wb *excelize.File, conf config, vmixState *state, b *bible, lect *lectionaryDay) {
+	rows, _ := wb.GetRows("Readings")
+	for idx, row := range rows {
+		if idx == 0 || len(row) < 4 || row[0] == "" {
+			continue
+		}
+
+		r := new(reading)
+		r.input = row[1]
+		r.input = resolveInput(vmixState, r.input)
+		r.button, _ = strconv.Atoi(row[2])
+		r.reference = row[3]
+		r.tbName = vmixState.overlayTBNames[r.input]
+		if len(row) > 4 {
+			r.refTbName = row[4]
+		}
+
+		// A reference such as "Lectionary Gospel" is the reading of the day
+		var err error
+		r.reference, err = lectionaryReading(lect, r.reference)
+		if err == nil {
+			err = lookupReading(r, conf, b)
+		}
+		if err != nil {
+			fmt.Println("Error in Readings,", row[0]+":", err)
+			continue
+		}
+		conf.reading[r.button] = r
+	}
+}
+
+// lookupReading fills the verses of a reading from its reference
+func lookupReading(r *reading, conf config, b *bible) error {
+	if b == nil {
+		return fmt.Errorf("no Bible File in the Settings sheet")
+	}
+	texts, refs, err := b.passage(r.reference)
+	if err != nil {
+		return err
+	}
+
+	// A verse too long for the title is split into pages that share its reference
+	r.verses = nil
+	r.refs = nil
+	for i, text := range texts {
+		for _, page := range paginate(conf, r.input, []string{text}) {
+			r.verses = append(r.verses, page)
+			r.refs = append(r.refs, refs[i])
+		}
+	}
+	return nil
+}
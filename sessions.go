@@ -0,0 +1,167 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+)
+
+// verseSessions keeps the place of each hymn, prayer, prayer of the people and reading, and
+// which of them is on air
+var verseSessions = struct {
+	lock     sync.Mutex
+	active   int
+	sessions map[int]*verses
+}{sessions: make(map[int]*verses)}
+
+// itemVerses returns the verses of the hymn, prayer, prayer of the people or reading of a button
+func itemVerses(conf config, button int) (verses, bool) {
+	if item, ok := conf.hymn[button]; ok {
+		return verses{button: button, input: item.input, tbName: item.tbName, verses: item.verses,
+			second: item.second, overlay: item.overlay}, true
+	}
+	if item, ok := conf.prayer[button]; ok {
+		return verses{button: button, input: item.input, tbName: item.tbName, verses: item.verses,
+			second: item.second, overlay: item.overlay}, true
+	}
+	if item, ok := conf.pop[button]; ok {
+		return verses{button: button, input: item.input, tbName: item.tbName, verses: item.verses,
+			second: item.second, overlay: item.overlay}, true
+	}
+	if item, ok := conf.reading[button]; ok {
+		return verses{button: button, input: item.input, tbName: item.tbName, verses: item.verses,
+			refTbName: item.refTbName, refs: item.refs, overlay: item.overlay}, true
+	}
+	return verses{}, false
+}
+
+// startVerses puts the item of a button on air and shows its verse. It returns false when the
+// item has no verses left to show.
+func startVerses(conf config, button int, verseChan chan verses) bool {
+	item, ok := itemVerses(conf, button)
+	if !ok || len(item.verses) == 0 {
+		return false
+	}
+	_, isPop := conf.pop[button]
+
+	verseSessions.lock.Lock()
+	session, resumed := verseSessions.sessions[button]
+	switch {
+	case !resumed || session.verseIndex < 0 || session.verseIndex >= len(session.verses):
+		session = &item
+	case verseSessions.active == button && isPop:
+		session.verseIndex++
+	case verseSessions.active == button:
+		session = &item
+	}
+	if session.verseIndex >= len(session.verses) {
+		// The last response of a prayer of the people was shown
+		delete(verseSessions.sessions, button)
+		verseSessions.active = 0
+		verseSessions.lock.Unlock()
+		return false
+	}
+	verseSessions.sessions[button] = session
+	verseSessions.active = button
+	shown := *session
+	verseSessions.lock.Unlock()
+
+	verseChan <- shown
+	return true
+}
+
+// stepVerses moves the item on air by a number of verses. It returns false when no item is on
+// air.
+func stepVerses(step int, verseChan chan verses) bool {
+	verseSessions.lock.Lock()
+	session, ok := verseSessions.sessions[verseSessions.active]
+	if !ok {
+		verseSessions.lock.Unlock()
+		return false
+	}
+	// One step past either end, so the first step back shows the first or last verse again
+	session.verseIndex += step
+	if session.verseIndex < -1 {
+		session.verseIndex = -1
+	}
+	if session.verseIndex > len(session.verses) {
+		session.verseIndex = len(session.verses)
+	}
+	shown := *session
+	verseSessions.lock.Unlock()
+
+	if shown.verseIndex >= 0 && shown.verseIndex < len(shown.verses) {
+		verseChan <- shown
+	}
+	return true
+}
+
+// showVerse shows a verse of the item on air
+func showVerse(index int, verseChan chan verses) {
+	verseSessions.lock.Lock()
+	session, ok := verseSessions.sessions[verseSessions.active]
+	if !ok || index < 0 || index >= len(session.verses) {
+		verseSessions.lock.Unlock()
+		return
+	}
+	session.verseIndex = index
+	shown := *session
+	verseSessions.lock.Unlock()
+
+	verseChan <- shown
+}
+
+// activeVerses returns the item on air
+func activeVerses() (verses, bool) {
+	verseSessions.lock.Lock()
+	defer verseSessions.lock.Unlock()
+	session, ok := verseSessions.sessions[verseSessions.active]
+	if !ok {
+		return verses{}, false
+	}
+	return *session, true
+}
+
+// stopVerses takes the item off the air, keeping its place. It returns the item that was on air.
+func stopVerses() verses {
+	verseSessions.lock.Lock()
+	defer verseSessions.lock.Unlock()
+	var stopped verses
+	if session, ok := verseSessions.sessions[verseSessions.active]; ok {
+		stopped = *session
+	}
+	verseSessions.active = 0
+	return stopped
+}
+
+// restoreVerses puts back an item on air at the verse it was at, ex: from a snapshot
+func restoreVerses(item verses) {
+	verseSessions.lock.Lock()
+	defer verseSessions.lock.Unlock()
+	verseSessions.sessions[item.button] = &item
+	verseSessions.active = item.button
+}
+
+// resetVerses forgets the place of the item of a button, or of all of them when button is 0
+func resetVerses(button int) {
+	verseSessions.lock.Lock()
+	defer verseSessions.lock.Unlock()
+	if button == 0 {
+		verseSessions.sessions = make(map[int]*verses)
+		verseSessions.active = 0
+		return
+	}
+	delete(verseSessions.sessions, button)
+	if verseSessions.active == button {
+		verseSessions.active = 0
+	}
+}
+
+// versesCommand runs verses reset [button]
+func versesCommand(args []string) {
+	button := 0
+	if len(args) > 1 {
+		button, _ = strconv.Atoi(args[1])
+	}
+	debug("Resetting verses", button)
+	resetVerses(button)
+}
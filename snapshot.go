@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type snapshot struct {
+	Name          string
+	Input         int
+	Preview       int
+	Overlays      [4]int
+	InputAudio    map[int]bool
+	InputVolume   map[int]float64
+	InputBuses    map[int]string
+	CameraPresets map[string]string
+	verses        verses
+}
+
+type snapshotStore struct {
+	lock      sync.Mutex
+	fileName  string
+	snapshots map[string]*snapshot
+}
+
+// snapshots holds the named snapshots. They are saved to a JSON file so they survive a restart.
+var snapshots = &snapshotStore{snapshots: make(map[string]*snapshot)}
+
+// loadSnapshots reads the named snapshots saved in fileName. A missing file is not an error.
+func loadSnapshots(fileName string) {
+	snapshots.lock.Lock()
+	defer snapshots.lock.Unlock()
+	snapshots.fileName = fileName
+
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		debug("No snapshots loaded:", err)
+		return
+	}
+	if err := json.Unmarshal(data, &snapshots.snapshots); err != nil {
+		fmt.Println("Error reading snapshots from", fileName+":", err)
+	}
+}
+
+// saveSnapshot captures the current state under a name and writes all snapshots to disk
+func saveSnapshot(name string, conf config, vmixState *state) error {
+	snap := takeSnapshot(vmixState, conf)
+	snap.Name = name
+
+	snapshots.lock.Lock()
+	defer snapshots.lock.Unlock()
+	snapshots.snapshots[strings.ToLower(name)] = snap
+
+	if snapshots.fileName == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(snapshots.snapshots, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(snapshots.fileName, data, 0644)
+}
+
+// recallSnapshot moves vMix to the named snapshot
+func recallSnapshot(name string, client *vmixClient, conf config, vmixState *state) error {
+	snapshots.lock.Lock()
+	snap, ok := snapshots.snapshots[strings.ToLower(name)]
+	snapshots.lock.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown snapshot %q", name)
+	}
+	debug("Recalling snapshot", name)
+	restoreSnapshot(client, snap, conf, vmixState)
+	return nil
+}
+
+// snapshotNames returns the names of the saved snapshots in alphabetical order
+func snapshotNames() []string {
+	snapshots.lock.Lock()
+	defer snapshots.lock.Unlock()
+	var names []string
+	for _, snap := range snapshots.snapshots {
+		names = append(names, snap.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// takeSnapshot captures the parts of the vMix state that we change during a service
+func takeSnapshot(vmixState *state, conf config) *snapshot {
+	vmixState.lock.RLock()
+	defer vmixState.lock.RUnlock()
+
+	snap := new(snapshot)
+	snap.Input = vmixState.Input
+	snap.Preview = vmixState.InputPreview
+	for channel := 1; channel <= 4; channel++ {
+		snap.Overlays[channel-1] = overlayInput(vmixState, channel)
+	}
+
+	snap.InputAudio = make(map[int]bool)
+	for input, on := range vmixState.InputAudio {
+		snap.InputAudio[input] = on
+	}
+	snap.InputVolume = make(map[int]float64)
+	for input, volume := range vmixState.InputVolume {
+		snap.InputVolume[input] = volume
+	}
+	snap.InputBuses = make(map[int]string)
+	for _, bus := range audioBuses {
+		for input, on := range busAudio(vmixState, bus) {
+			if on {
+				snap.InputBuses[input] += bus
+			}
+		}
+	}
+
+	snap.CameraPresets = make(map[string]string)
+	for name, cam := range conf.camera {
+		cam.lock.Lock()
+		if cam.preset != "" {
+			snap.CameraPresets[name] = cam.preset
+		}
+		cam.lock.Unlock()
+	}
+
+	snap.verses, _ = activeVerses()
+	return snap
+}
+
+// snapshotDiff returns the vMix functions needed to move from the current state to the target
+// snapshot. Anything that already matches is left alone.
+func snapshotDiff(current, target *snapshot) []string {
+	var functions []string
+
+	if target.Input != 0 && target.Input != current.Input {
+		functions = append(functions, "CutDirect Input="+strconv.Itoa(target.Input))
+	}
+	if target.Preview != 0 && target.Preview != current.Preview {
+		functions = append(functions, "PreviewInput Input="+strconv.Itoa(target.Preview))
+	}
+
+	for idx, input := range target.Overlays {
+		channel := strconv.Itoa(idx + 1)
+		if input == current.Overlays[idx] {
+			continue
+		}
+		if input == 0 {
+			functions = append(functions, "OverlayInput"+channel+"Out")
+		} else {
+			functions = append(functions, "OverlayInput"+channel+"In Input="+strconv.Itoa(input))
+		}
+	}
+
+	for input, on := range target.InputAudio {
+		if current.InputAudio[input] == on {
+			continue
+		}
+		if on {
+			functions = append(functions, "AudioOn Input="+strconv.Itoa(input))
+		} else {
+			functions = append(functions, "AudioOff Input="+strconv.Itoa(input))
+		}
+	}
+
+	for input, volume := range target.InputVolume {
+		if math.Round(current.InputVolume[input]) != math.Round(volume) {
+			functions = append(functions, "SetVolume Input="+strconv.Itoa(input)+
+				"&Value="+strconv.Itoa(int(math.Round(volume))))
+		}
+	}
+
+	// Compare bus assignments for every input known to either snapshot
+	inputs := make(map[int]bool)
+	for input := range target.InputBuses {
+		inputs[input] = true
+	}
+	for input := range current.InputBuses {
+		inputs[input] = true
+	}
+	for input := range inputs {
+		for _, bus := range audioBuses {
+			want := strings.Contains(target.InputBuses[input], bus)
+			if want == strings.Contains(current.InputBuses[input], bus) {
+				continue
+			}
+			if want {
+				functions = append(functions, "AudioBusOn Value="+bus+"&Input="+strconv.Itoa(input))
+			} else {
+				functions = append(functions, "AudioBusOff Value="+bus+"&Input="+strconv.Itoa(input))
+			}
+		}
+	}
+
+	return functions
+}
+
+// restoreSnapshot sends only the functions needed to return to the snapshot, moves the
+// cameras to their saved presets and restores verse paging.
+func restoreSnapshot(client *vmixClient, snap *snapshot, conf config, vmixState *state) {
+	current := takeSnapshot(vmixState, conf)
+
+	for _, function := range snapshotDiff(current, snap) {
+		_ = SendMessage(client, "FUNCTION "+function)
+	}
+
+	for name, preset := range snap.CameraPresets {
+		if cam, ok := conf.camera[name]; ok && current.CameraPresets[name] != preset {
+			go cameraPreset(cam, preset)
+		}
+	}
+
+	if snap.verses.input != "" {
+		restoreVerses(snap.verses)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"github.com/360EntSecGroup-Skylar/excelize/v2"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// speakerShown is the speaker on air. generation changes each time a speaker is shown or
+// hidden, so a pending automatic hide knows it is stale.
+var speakerShown = struct {
+	lock       sync.Mutex
+	button     int
+	generation int
+}{}
+
+// loadSpeakers reads the Speakers sheet, one lower third per row
+func loadSpeakers(wb *excelize.File, conf config, vmixState *state) {
+	fields := loadSpeakerFields(wb, vmixState)
+
+	spkRows, _ := wb.GetRows("Speakers")
+	for idx, row := range spkRows {
+		if idx == 0 || len(row) < 3 {
+			continue
+		}
+		for len(row) < 9 {
+			row = append(row, "")
+		}
+
+		btn, _ := strconv.Atoi(row[1])
+		input := resolveInput(vmixState, row[2])
+
+		sp := &speaker{
+			button: btn,
+			input:  input,
+			script: row[3],
+			name:   row[4],
+			tbName: vmixState.overlayTBNames[input],
+			texts:  make(map[string]string),
+			images: make(map[string]string),
+		}
+
+		// The fields of the title in the order Name, Role, Organization, Photo
+		titleFields := vmixState.titleFields[input]
+		names := []string{"", fieldAt(titleFields, 1), fieldAt(titleFields, 2), fieldAt(vmixState.titleImages[input], 0)}
+		if named, ok := fields[strings.ToLower(input)]; ok {
+			names = named
+		}
+		if names[0] != "" {
+			sp.tbName = names[0]
+		}
+		// A speaker sets every field of the title, even when it is empty, so nothing is left
+		// over from the previous speaker
+		var err error
+		for i, column := range []string{"role", "organization", "photo"} {
+			field, value := names[i+1], row[5+i]
+			switch {
+			case field == "" && value != "":
+				err = fmt.Errorf("%s has no field for the %s", input, column)
+			case field == "":
+			case column == "photo":
+				sp.images[field] = value
+			default:
+				sp.texts[field] = value
+			}
+		}
+
+		// The image fields of the stage title are matched to those of the speaker title by position
+		sp.stageImages = stageImages(vmixState.titleImages[input],
+			vmixState.titleImages[resolveInput(vmixState, conf.misc["Stage Title"])], sp.images)
+
+		hideAfter := row[8]
+		if hideAfter == "" {
+			hideAfter = conf.misc["Speaker Hide After"]
+		}
+		if err == nil && hideAfter != "" {
+			seconds, convErr := strconv.ParseFloat(hideAfter, 64)
+			if convErr != nil || seconds < 0 {
+				err = fmt.Errorf("Hide After must be a number of seconds")
+			}
+			sp.hideAfter = time.Duration(seconds * float64(time.Second))
+		}
+		if err != nil {
+			fmt.Println("Error in Speakers,", row[0]+":", err)
+			continue
+		}
+		conf.speaker[btn] = sp
+	}
+}
+
+// loadSpeakerFields reads the Speaker Fields sheet. The names are checked against the fields of
+// the title.
+func loadSpeakerFields(wb *excelize.File, vmixState *state) map[string][]string {
+	fields := make(map[string][]string)
+	rows, _ := wb.GetRows("Speaker Fields")
+	for idx, row := range rows {
+		if idx == 0 || len(row) < 2 || row[0] == "" {
+			continue
+		}
+		for len(row) < 5 {
+			row = append(row, "")
+		}
+
+		input := resolveInput(vmixState, row[0])
+		names := []string{row[1], row[2], row[3], row[4]}
+		for i, name := range names {
+			known := vmixState.titleFields[input]
+			if i == 3 {
+				known = vmixState.titleImages[input]
+			}
+			if _, ok := vmixState.titleFields[input]; ok && name != "" && !containsKeyword(known, name) {
+				fmt.Println("Error in Speaker Fields,", row[0]+":", input, "has no field", name)
+			}
+		}
+		fields[strings.ToLower(input)] = names
+	}
+	return fields
+}
+
+func fieldAt(fields []string, i int) string {
+	if i < len(fields) {
+		return fields[i]
+	}
+	return ""
+}
+
+// showSpeaker puts the lower third of a speaker on air, or on Preview in stage mode
+func showSpeaker(client *vmixClient, conf config, midiOutChan chan apcLEDS, vmixState *state, sp *speaker) {
+	if len(sp.script) > 1 {
+		_ = SendMessage(client, "FUNCTION ScriptStart Value="+url.QueryEscape(sp.script))
+		//Give the script some time to complete
+		time.Sleep(time.Millisecond * 500)
+	}
+
+	texts := make(map[string]string)
+	sp.overlay.setText(texts, sp.tbName, sp.name)
+	for tbName, text := range sp.texts {
+		texts[tbName] = text
+	}
+	onAir := func() {
+		speakerOnAir(client, conf, midiOutChan, vmixState, sp)
+	}
+	if stageText(client, conf, midiOutChan, stagedText{input: sp.input, texts: texts, images: sp.images,
+		stageImages: sp.stageImages, overlay: sp.overlay, taken: onAir}) {
+		return
+	}
+
+	setTexts(client, sp.input, texts)
+	setImages(client, sp.input, sp.images)
+	// Wait a bit to ensure title text is changed
+	time.Sleep(time.Millisecond * 300)
+	_ = SendMessage(client, sp.overlay.showFunction(sp.input))
+	onAir()
+}
+
+// speakerOnAir lights the button of the speaker on air and starts its automatic hide
+func speakerOnAir(client *vmixClient, conf config, midiOutChan chan apcLEDS, vmixState *state, sp *speaker) {
+	speakerShown.lock.Lock()
+	previous := speakerShown.button
+	speakerShown.button = sp.button
+	speakerShown.generation++
+	generation := speakerShown.generation
+	speakerShown.lock.Unlock()
+
+	if previous != 0 && previous != sp.button {
+		restoreLED(previous, conf, midiOutChan)
+	}
+	midiOutChan <- apcLEDS{
+		buttons: []int{sp.button},
+		color:   "red",
+	}
+
+	if sp.hideAfter > 0 {
+		go func() {
+			time.Sleep(sp.hideAfter)
+			speakerShown.lock.Lock()
+			current := speakerShown.generation == generation
+			if current {
+				speakerShown.button = 0
+				speakerShown.generation++
+			}
+			speakerShown.lock.Unlock()
+
+			if !current {
+				return
+			}
+			// The title may have been replaced on its channel from vMix
+			number := inputNumber(vmixState, sp.input)
+			vmixState.lock.RLock()
+			onAir := overlayInput(vmixState, sp.overlay.channelNumber()) == number
+			vmixState.lock.RUnlock()
+			if onAir {
+				debug("Hiding speaker", sp.name)
+				_ = SendMessage(client, sp.overlay.hideFunction())
+			}
+			restoreLED(sp.button, conf, midiOutChan)
+		}()
+	}
+}
+
+// overlayShown forgets the speaker on air when another title is shown on its overlay channel
+func overlayShown(ov *overlay, conf config, midiOutChan chan apcLEDS) {
+	speakerShown.lock.Lock()
+	button := speakerShown.button
+	sp, ok := conf.speaker[button]
+	replaced := ok && sp.overlay.channelNumber() == ov.channelNumber()
+	if replaced {
+		speakerShown.button = 0
+		speakerShown.generation++
+	}
+	speakerShown.lock.Unlock()
+
+	if replaced {
+		restoreLED(button, conf, midiOutChan)
+	}
+}
+
+// hideSpeaker takes the speaker on air out
+func hideSpeaker(client *vmixClient, conf config, midiOutChan chan apcLEDS) {
+	speakerShown.lock.Lock()
+	button := speakerShown.button
+	speakerShown.button = 0
+	speakerShown.generation++
+	speakerShown.lock.Unlock()
+
+	sp, ok := conf.speaker[button]
+	if !ok {
+		return
+	}
+	_ = SendMessage(client, sp.overlay.hideFunction())
+	restoreLED(button, conf, midiOutChan)
+}
+
+// setImages sets several image fields of a title
+func setImages(client *vmixClient, input string, images map[string]string) {
+	for field, path := range images {
+		_ = SendMessage(client, "FUNCTION SetImage Input="+url.QueryEscape(input)+"&SelectedName="+
+			url.QueryEscape(field)+"&Value="+url.QueryEscape(path))
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// stagedText is a title waiting on Preview for the Take button
+type stagedText struct {
+	input       string
+	texts       map[string]string
+	images      map[string]string
+	stageImages map[string]string
+	second      string
+	overlay     *overlay
+	taken       func()
+}
+
+var staging = struct {
+	lock    sync.Mutex
+	enabled bool
+	item    *stagedText
+}{}
+
+// loadStaging reads the initial stage mode from the Settings sheet
+func loadStaging(conf config) {
+	mode := strings.ToLower(conf.misc["Stage Mode"])
+	staging.enabled = conf.misc["Stage Title"] != "" && (mode == "yes" || mode == "y" || mode == "on")
+}
+
+func takeButton(conf config) int {
+	button, _ := strconv.Atoi(conf.misc["Take Button"])
+	return button
+}
+
+// stageText shows text in a title. In stage mode it goes to the stage title on Preview,
+// otherwise straight to the title on its overlay. It returns true when the text was staged.
+func stageText(client *vmixClient, conf config, midiOutChan chan apcLEDS, item stagedText) bool {
+	staging.lock.Lock()
+	defer staging.lock.Unlock()
+
+	stageTitle := conf.misc["Stage Title"]
+	if !staging.enabled || stageTitle == "" {
+		return false
+	}
+
+	debug("Staging", item.texts, "for", item.input)
+	staging.item = &item
+	setTexts(client, stageTitle, item.texts)
+	setImages(client, stageTitle, item.stageImages)
+	_ = SendMessage(client, "FUNCTION PreviewInput Input="+url.QueryEscape(stageTitle))
+
+	if button := takeButton(conf); button != 0 {
+		midiOutChan <- apcLEDS{
+			buttons: []int{button},
+			color:   "greenBlink",
+		}
+	}
+	return true
+}
+
+// takeStaged puts the staged text on air in its own title
+func takeStaged(client *vmixClient, conf config, midiOutChan chan apcLEDS) {
+	staging.lock.Lock()
+	item := staging.item
+	staging.item = nil
+	staging.lock.Unlock()
+
+	if item == nil {
+		return
+	}
+	debug("Taking", item.texts)
+	setTexts(client, item.input, item.texts)
+	setImages(client, item.input, item.images)
+	showSecondTitle(client, conf, item.input, item.second)
+	overlayShown(item.overlay, conf, midiOutChan)
+	_ = SendMessage(client, item.overlay.showFunction(item.input))
+	if item.taken != nil {
+		item.taken()
+	}
+
+	if button := takeButton(conf); button != 0 {
+		restoreLED(button, conf, midiOutChan)
+	}
+}
+
+// stageCommand switches stage mode: stage on, stage off or stage toggle
+func stageCommand(conf config, midiOutChan chan apcLEDS, arg string) {
+	staging.lock.Lock()
+	switch arg {
+	case "on":
+		staging.enabled = true
+	case "off":
+		staging.enabled = false
+	case "toggle":
+		staging.enabled = !staging.enabled
+	}
+	enabled := staging.enabled
+	dropped := !enabled && staging.item != nil
+	if !enabled {
+		staging.item = nil
+	}
+	staging.lock.Unlock()
+
+	debug("Stage mode:", enabled)
+	if button := takeButton(conf); button != 0 && dropped {
+		restoreLED(button, conf, midiOutChan)
+	}
+}
+
+// stageImages renames image fields of a title to the fields of the stage title at the same
+// position. Images the stage title has no field for are left out.
+func stageImages(fields, stageFields []string, images map[string]string) map[string]string {
+	staged := make(map[string]string)
+	for i, field := range fields {
+		if path, ok := images[field]; ok && i < len(stageFields) {
+			staged[stageFields[i]] = path
+		}
+	}
+	return staged
+}
+
+// setTexts sets several textboxes of a title
+func setTexts(client *vmixClient, input string, texts map[string]string) {
+	for tbName, text := range texts {
+		_ = SendMessage(client, "FUNCTION SetText Input="+url.QueryEscape(input)+"&SelectedName="+
+			url.QueryEscape(tbName)+"&Value="+url.QueryEscape(text))
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"github.com/360EntSecGroup-Skylar/excelize/v2"
+	"strconv"
+	"strings"
+)
+
+type toggle struct {
+	button   int
+	property string
+	arg      string
+	input    string
+	onColor  string
+	offColor string
+}
+
+// loadToggles reads the Toggles sheet, which binds buttons to on/off properties of vMix
+func loadToggles(wb *excelize.File, conf config, vmixState *state) {
+	rows, _ := wb.GetRows("Toggles")
+	for idx, row := range rows {
+		if idx == 0 || len(row) < 2 || row[0] == "" {
+			continue
+		}
+
+		t := new(toggle)
+		t.button, _ = strconv.Atoi(row[0])
+		t.onColor = "green"
+		t.offColor = "off"
+
+		parts := strings.Fields(strings.ToLower(row[1]))
+		if len(parts) == 0 {
+			continue
+		}
+		t.property = parts[0]
+		if len(parts) > 1 {
+			t.arg = strings.ToUpper(parts[1])
+		}
+		// The input is kept by name and looked up when the toggle is used, so inputs can be
+		// renumbered in vMix
+		if len(row) > 2 {
+			t.input = strings.TrimSpace(row[2])
+		}
+		if len(row) > 3 && row[3] != "" {
+			t.onColor = row[3]
+		}
+		if len(row) > 4 && row[4] != "" {
+			t.offColor = row[4]
+		}
+
+		if err := checkToggle(t, vmixState); err != nil {
+			fmt.Println("Error in Toggles, button", row[0]+":", err)
+			continue
+		}
+		conf.toggle[t.button] = t
+	}
+}
+
+func checkToggle(t *toggle, vmixState *state) error {
+	switch t.property {
+	case "bus":
+		if !containsBus(audioBuses, t.arg) {
+			return fmt.Errorf("unknown audio bus %q", t.arg)
+		}
+	case "overlay":
+		if channel, err := strconv.Atoi(t.arg); err != nil || channel < 1 || channel > 4 {
+			return fmt.Errorf("overlay channel must be 1-4")
+		}
+	case "mute", "loop", "recording", "streaming":
+	default:
+		return fmt.Errorf("unknown property %q", t.property)
+	}
+
+	switch t.property {
+	case "bus", "overlay", "mute", "loop":
+		if inputNumber(vmixState, t.input) == 0 {
+			return fmt.Errorf("unknown input")
+		}
+	}
+
+	for _, color := range []string{t.onColor, t.offColor} {
+		if err := checkLEDColor(color); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// toggleOn returns the current value of the toggle's property from the vMix state
+func toggleOn(t *toggle, vmixState *state) bool {
+	input := inputNumber(vmixState, t.input)
+	vmixState.lock.RLock()
+	defer vmixState.lock.RUnlock()
+
+	switch t.property {
+	case "bus":
+		return busAudio(vmixState, t.arg)[input]
+	case "mute":
+		// Inputs we know nothing about are treated as not muted
+		on, ok := vmixState.InputAudio[input]
+		return ok && !on
+	case "overlay":
+		channel, _ := strconv.Atoi(t.arg)
+		return input != 0 && overlayInput(vmixState, channel) == input
+	case "recording":
+		return vmixState.Recording == 1
+	case "streaming":
+		return vmixState.Streaming == 1
+	case "loop":
+		return vmixState.InputLoop[input]
+	}
+	return false
+}
+
+// flipToggle sends the function that turns the toggle's property to the opposite of its
+// current state.
+func flipToggle(client *vmixClient, t *toggle, vmixState *state) {
+	on := toggleOn(t, vmixState)
+	number := inputNumber(vmixState, t.input)
+	input := strconv.Itoa(number)
+	var m string
+
+	switch t.property {
+	case "bus":
+		m = "AudioBusOn Value=" + t.arg + "&Input=" + input
+		if on {
+			m = "AudioBusOff Value=" + t.arg + "&Input=" + input
+		}
+	case "mute":
+		m = "AudioOff Input=" + input
+		if on {
+			m = "AudioOn Input=" + input
+		}
+	case "overlay":
+		m = "OverlayInput" + t.arg + "In Input=" + input
+		if on {
+			m = "OverlayInput" + t.arg + "Out"
+		}
+	case "recording":
+		m = "StartRecording"
+		if on {
+			m = "StopRecording"
+		}
+	case "streaming":
+		m = "StartStreaming"
+		if on {
+			m = "StopStreaming"
+		}
+	case "loop":
+		m = "LoopOn Input=" + input
+		if on {
+			m = "LoopOff Input=" + input
+		}
+		// Loop changes are not reported by the activator feed, so update the state ourselves
+		vmixState.lock.Lock()
+		vmixState.InputLoop[number] = !on
+		vmixState.lock.Unlock()
+		publish(vmixState)
+	}
+
+	debug("Toggle", t.button, "->", m)
+	_ = SendMessage(client, "FUNCTION "+m)
+}
+
+// runToggles keeps the LEDs of the toggle buttons in line with the vMix state.
+// This is a blocking function.
+func runToggles(conf config, vmixState *state, midiOutChan chan apcLEDS) {
+	if len(conf.toggle) == 0 {
+		return
+	}
+
+	shown := make(map[int]string)
+	events := subscribe(vmixState)
+	for {
+		for button, t := range conf.toggle {
+			color := t.offColor
+			if toggleOn(t, vmixState) {
+				color = t.onColor
+			}
+			if shown[button] != color {
+				shown[button] = color
+				midiOutChan <- apcLEDS{
+					buttons: []int{button},
+					color:   color,
+				}
+			}
+		}
+		<-events
+	}
+}
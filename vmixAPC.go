@@ -17,7 +17,6 @@ import (
 	"gitlab.com/gomidi/rtmididrv"
 	"net"
 	"net/http"
-	"net/url"
 	"os"
 	"os/exec"
 	"strconv"
@@ -48,56 +47,76 @@ type response struct {
 	input    string
 	tbName   string
 	response string
+	second   string
+	overlay  *overlay
 }
 
 type shortcut struct {
 	button          int
-	actionsPressed  []string
-	actionsReleased []string
+	actionsPressed  *script
+	actionsReleased *script
+	confirm         time.Duration
+	err             error
 }
 
 type prayer struct {
-	button int
-	input  string
-	tbName string
-	verses []string
+	button  int
+	input   string
+	tbName  string
+	verses  []string
+	second  []string
+	overlay *overlay
 }
 
 type pop struct {
-	button      int
-	input       string
-	tbName      string
-	verses      []string
-	initialized bool
+	button  int
+	input   string
+	tbName  string
+	verses  []string
+	second  []string
+	overlay *overlay
 }
 
 type hymn struct {
-	button int
-	input  string
-	tbName string
-	verses []string
+	button  int
+	input   string
+	tbName  string
+	verses  []string
+	second  []string
+	overlay *overlay
 }
 
 type verses struct {
+	button     int
 	input      string
 	tbName     string
 	verses     []string
 	verseIndex int
+	refTbName  string
+	refs       []string
+	second     []string
+	overlay    *overlay
 }
 
 type speaker struct {
-	button int
-	input  string
-	script string
-	name   string
-	tbName string
+	button      int
+	input       string
+	script      string
+	name        string
+	tbName      string
+	texts       map[string]string
+	images      map[string]string
+	stageImages map[string]string
+	hideAfter   time.Duration
+	overlay     *overlay
 }
 
 type activator struct {
 	trigger   string
 	input     string
-	onAction  []string
-	offAction []string
+	rule      inputRule
+	onAction  *script
+	offAction *script
 }
 
 type camera struct {
@@ -106,6 +125,8 @@ type camera struct {
 	user     string
 	password string
 	mode     string
+	preset   string // guarded by lock, set from goroutines
+	lock     sync.Mutex
 }
 
 type fader struct {
@@ -116,7 +137,7 @@ type fader struct {
 type config struct {
 	camera    map[string]*camera
 	fader     map[int]*fader
-	activator map[string]*map[string]activator
+	activator map[string][]*activator
 	prayer    map[int]*prayer
 	pop       map[int]*pop
 	shortcut  map[int]*shortcut
@@ -125,6 +146,16 @@ type config struct {
 	speaker   map[int]*speaker
 	initial   map[int]string
 	mics      map[string]string
+	micScene  map[string]*micScene
+	ducking   map[string]*duckRule
+	toggle    map[int]*toggle
+	macro     map[string]*macro
+	schedule  map[string]*scheduleEntry
+	cues      []*cue
+	reading   map[int]*reading
+	layout    map[string]*titleLayout
+	language  map[string]*language
+	overlay   map[string]*overlay
 	misc      map[string]string
 }
 
@@ -143,9 +174,22 @@ type state struct {
 	InputMasterAudio map[int]bool
 	InputBusAAudio   map[int]bool
 	InputBusBAudio   map[int]bool
+	InputBusCAudio   map[int]bool
+	InputBusDAudio   map[int]bool
+	InputBusEAudio   map[int]bool
+	InputBusFAudio   map[int]bool
+	InputBusGAudio   map[int]bool
+	InputAudio       map[int]bool
+	InputLoop        map[int]bool
+	InputVolume      map[int]float64
+	InputMeter       map[int]float64
 	nameToNumber     map[string]string
 	numberToName     map[string]string
 	overlayTBNames   map[string]string
+	titleFields      map[string][]string
+	titleImages      map[string][]string
+	subscribers      []chan struct{}
+	lock             sync.RWMutex
 }
 
 type midiPorts struct {
@@ -158,7 +202,17 @@ type apcLEDS struct {
 	color   string
 }
 
-var currentVerses = new(verses)
+// ledValues are the MIDI velocities that set the color of an APC Mini button
+var ledValues = map[string]uint8{
+	"green":       1,
+	"greenBlink":  2,
+	"red":         3,
+	"redBlink":    4,
+	"yellow":      5,
+	"yellowBlink": 6,
+	"on":          1, // for round buttons - they can only be red/green (on)
+	"blink":       2, // or red/green blinking (blink)
+}
 
 // Translate from the APC midi mapping (0 is left button on last row
 // to more logical numbering where 1 is the top-left button
@@ -217,20 +271,78 @@ func debug(msg ...interface{}) {
 	}
 }
 
-func newState() state {
+func newState() *state {
 	var vmixState = new(state)
 	vmixState.InputBusAAudio = make(map[int]bool)
 	vmixState.InputBusBAudio = make(map[int]bool)
+	vmixState.InputBusCAudio = make(map[int]bool)
+	vmixState.InputBusDAudio = make(map[int]bool)
+	vmixState.InputBusEAudio = make(map[int]bool)
+	vmixState.InputBusFAudio = make(map[int]bool)
+	vmixState.InputBusGAudio = make(map[int]bool)
 	vmixState.InputMasterAudio = make(map[int]bool)
 	vmixState.InputPlaying = make(map[int]bool)
+	vmixState.InputAudio = make(map[int]bool)
+	vmixState.InputLoop = make(map[int]bool)
+	vmixState.InputVolume = make(map[int]float64)
+	vmixState.InputMeter = make(map[int]float64)
 	vmixState.nameToNumber = make(map[string]string)
 	vmixState.numberToName = make(map[string]string)
 	vmixState.overlayTBNames = make(map[string]string)
-	return *vmixState
+	vmixState.titleFields = make(map[string][]string)
+	vmixState.titleImages = make(map[string][]string)
+	return vmixState
+}
+
+// busAudio returns the state map of the inputs assigned to an audio bus (M, A-G).
+// The caller must hold the state lock.
+func busAudio(vmixState *state, bus string) map[int]bool {
+	switch bus {
+	case "M":
+		return vmixState.InputMasterAudio
+	case "A":
+		return vmixState.InputBusAAudio
+	case "B":
+		return vmixState.InputBusBAudio
+	case "C":
+		return vmixState.InputBusCAudio
+	case "D":
+		return vmixState.InputBusDAudio
+	case "E":
+		return vmixState.InputBusEAudio
+	case "F":
+		return vmixState.InputBusFAudio
+	case "G":
+		return vmixState.InputBusGAudio
+	}
+	return make(map[int]bool)
+}
+
+// subscribe returns a channel that is signalled after the vMix state has changed. Changes
+// made while the subscriber is busy are coalesced into one signal.
+func subscribe(vmixState *state) chan struct{} {
+	c := make(chan struct{}, 1)
+	vmixState.lock.Lock()
+	vmixState.subscribers = append(vmixState.subscribers, c)
+	vmixState.lock.Unlock()
+	return c
+}
+
+// publish tells the subscribers of the vMix state that it has changed. A subscriber that
+// already has a signal pending will see this change too, so it is never blocked on.
+func publish(vmixState *state) {
+	vmixState.lock.RLock()
+	defer vmixState.lock.RUnlock()
+	for _, c := range vmixState.subscribers {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
 }
 
 //setInitialState will set the LEDs on the APC mini to their initial (default) state
-func setInitialState(conf config, midiOutChan chan apcLEDS, vmixState state) {
+func setInitialState(conf config, midiOutChan chan apcLEDS, vmixState *state) {
 	initState := conf.initial
 	var redLeds apcLEDS
 	var yellowLeds apcLEDS
@@ -259,56 +371,57 @@ func setInitialState(conf config, midiOutChan chan apcLEDS, vmixState state) {
 	midiOutChan <- yellowLeds
 	midiOutChan <- greenLeds
 
+	// Shortcuts whose actions could not be parsed blink red until the workbook is fixed
+	for _, sc := range conf.shortcut {
+		if sc.err != nil {
+			midiOutChan <- apcLEDS{
+				buttons: []int{sc.button},
+				color:   "redBlink",
+			}
+		}
+	}
+
 	//Process activators based on current vmixState
 	// Process current vmixState map to set LEDs on board with current state
 	var vmixMessage string
 	var inputS string
 
+	vmixState.lock.RLock()
+	activeInput := vmixState.Input
+	busB := make(map[int]bool)
+	for input, active := range vmixState.InputBusBAudio {
+		busB[input] = active
+	}
+	vmixState.lock.RUnlock()
+
 	// Active input
-	inputS = strconv.Itoa(vmixState.Input)
+	inputS = strconv.Itoa(activeInput)
 	vmixMessage = "ACTS OK Input " + inputS + " 1"
-	processActivator(vmixMessage, midiOutChan, conf)
+	processActivator(vmixMessage, nil, midiOutChan, nil, conf, vmixState)
 
 	//Input has BusB assigned
-	for input, active := range vmixState.InputBusBAudio {
+	for input, active := range busB {
 
 		if active == true {
 			inputS = strconv.Itoa(input)
 			vmixMessage = "ACTS OK InputBusBAudio " + inputS + " 1"
-			processActivator(vmixMessage, midiOutChan, conf)
+			processActivator(vmixMessage, nil, midiOutChan, nil, conf, vmixState)
 		}
 		if active == false {
 			inputS = strconv.Itoa(input)
 			vmixMessage = "ACTS OK InputBusBAudio " + inputS + " 0"
-			processActivator(vmixMessage, midiOutChan, conf)
+			processActivator(vmixMessage, nil, midiOutChan, nil, conf, vmixState)
 		}
 	}
 }
 
 // updateVmixState will create a connection to the vMix API and query it to update the
 // vMix state variables with the current configuration
-func updateVmixState(vc vcConfig) state {
+func updateVmixState(vc vcConfig) *state {
 	client, _ := vmixAPIConnect(vc)
+	defer client.conn.Close()
 	vmixState := newState()
-	_, err := client.w.WriteString("XML\r\n")
-	if err == nil {
-		err = client.w.Flush()
-	}
-	var xml string
-	var cont bool
-	for cont = true; cont; {
-		line, _ := client.r.ReadString('\r')
-		if strings.Contains(line, "<vmix>") {
-			xml = xml + line
-		}
-		if strings.Contains(line, "</vmix>") {
-			xml = xml + line
-			cont = false
-		}
-	}
-
-	doc := etree.NewDocument()
-	_ = doc.ReadFromString(xml)
+	doc := readVmixXML(client)
 
 	for _, overlays := range doc.FindElements("./vmix/overlays/*") {
 		number := overlays.SelectAttrValue("number", "")
@@ -319,15 +432,15 @@ func updateVmixState(vc vcConfig) state {
 			case "1":
 				vmixState.Overlay1 = input
 			case "2":
-				vmixState.Overlay1 = input
+				vmixState.Overlay2 = input
 			case "3":
-				vmixState.Overlay1 = input
+				vmixState.Overlay3 = input
 			case "4":
-				vmixState.Overlay1 = input
+				vmixState.Overlay4 = input
 			case "5":
-				vmixState.Overlay1 = input
+				vmixState.Overlay5 = input
 			case "6":
-				vmixState.Overlay1 = input
+				vmixState.Overlay6 = input
 			}
 		}
 	}
@@ -345,18 +458,10 @@ func updateVmixState(vc vcConfig) state {
 		vmixState.numberToName[input] = name
 
 		if busses != "" {
-
-			if strings.Contains(busses, "A") {
-				//vmixStateMultiple["InputBusAAudio"] = map[string]bool{number: true}
-				vmixState.InputBusAAudio[number] = true
-			}
-			if strings.Contains(busses, "B") {
-				//vmixStateMultiple["InputBusBAudio"] = map[string]bool{number: true}
-				vmixState.InputBusBAudio[number] = true
-			}
-			if strings.Contains(busses, "M") {
-				//vmixStateMultiple["InputMasterAudio"] = map[string]bool{number: true}
-				vmixState.InputMasterAudio[number] = true
+			for _, bus := range audioBuses {
+				if strings.Contains(busses, bus) {
+					busAudio(vmixState, bus)[number] = true
+				}
 			}
 		}
 
@@ -364,11 +469,24 @@ func updateVmixState(vc vcConfig) state {
 			vmixState.InputPlaying[number] = true
 		}
 
-		// Get the textbox name for title inputs
+		// Mute state and volume. Only inputs with audio carry these attributes.
+		if muted := inputs.SelectAttrValue("muted", ""); muted != "" {
+			vmixState.InputAudio[number] = muted == "False"
+		}
+		if volume, err := strconv.ParseFloat(inputs.SelectAttrValue("volume", ""), 64); err == nil {
+			vmixState.InputVolume[number] = volume
+		}
+		vmixState.InputMeter[number] = inputMeter(inputs)
+		vmixState.InputLoop[number] = inputs.SelectAttrValue("loop", "") == "True"
+
+		// Get the textbox names for title inputs
 		if inputType == "GT" {
+			vmixState.titleFields[name] = titleNames(inputs, "text")
+			vmixState.titleImages[name] = titleNames(inputs, "image")
 			// If there are multiple text boxes, select the first (index 0)
-			textbox := inputs.SelectElement("text").SelectAttrValue("name", "")
-			vmixState.overlayTBNames[name] = textbox
+			if fields := vmixState.titleFields[name]; len(fields) > 0 {
+				vmixState.overlayTBNames[name] = fields[0]
+			}
 		}
 	}
 
@@ -394,9 +512,59 @@ func updateVmixState(vc vcConfig) state {
 	return vmixState
 }
 
+// readVmixXML requests the full vMix state from the API and returns it as an XML document
+func readVmixXML(client *vmixClient) *etree.Document {
+	client.lock.Lock()
+	_, err := client.w.WriteString("XML\r\n")
+	if err == nil {
+		err = client.w.Flush()
+	}
+	var xml string
+	var cont bool
+	for cont = err == nil; cont; {
+		line, err := client.r.ReadString('\r')
+		if strings.Contains(line, "<vmix>") {
+			xml = xml + line
+		}
+		if strings.Contains(line, "</vmix>") {
+			xml = xml + line
+			cont = false
+		}
+		if err != nil {
+			fmt.Println("Error reading XML from the vMix API:", err)
+			cont = false
+		}
+	}
+	client.lock.Unlock()
+
+	doc := etree.NewDocument()
+	_ = doc.ReadFromString(xml)
+	return doc
+}
+
+// titleNames returns the names of the text or image fields of a title input element
+func titleNames(input *etree.Element, kind string) []string {
+	var names []string
+	for _, field := range input.SelectElements(kind) {
+		names = append(names, field.SelectAttrValue("name", ""))
+	}
+	return names
+}
+
+// inputMeter returns the loudest of the two channel meters of an input element.
+// vMix reports the meters as amplitudes between 0 and 1.
+func inputMeter(input *etree.Element) float64 {
+	left, _ := strconv.ParseFloat(input.SelectAttrValue("meterF1", "0"), 64)
+	right, _ := strconv.ParseFloat(input.SelectAttrValue("meterF2", "0"), 64)
+	if right > left {
+		return right
+	}
+	return left
+}
+
 // newConfig initializes the configuration variable and loads it with the content of the configuration
 // spreadsheet.  It returns the new configuration variable
-func newConfig(filename string, vmixState state) config {
+func newConfig(filename string, vmixState *state) config {
 
 	var scConfig = make(map[int]*shortcut)
 	var respConfig = make(map[int]*response)
@@ -404,10 +572,20 @@ func newConfig(filename string, vmixState state) config {
 	var popConfig = make(map[int]*pop)
 	var hymnConfig = make(map[int]*hymn)
 	var speakerConfig = make(map[int]*speaker)
-	var activatorConfig = make(map[string]*map[string]activator)
+	var activatorConfig = make(map[string][]*activator)
 	var faderConfig = make(map[int]*fader)
 	var initialConfig = make(map[int]string)
 	var micsConfig = make(map[string]string)
+	var miscConfig = make(map[string]string)
+	var micSceneConfig = make(map[string]*micScene)
+	var duckingConfig = make(map[string]*duckRule)
+	var toggleConfig = make(map[int]*toggle)
+	var macroConfig = make(map[string]*macro)
+	var scheduleConfig = make(map[string]*scheduleEntry)
+	var layoutConfig = make(map[string]*titleLayout)
+	var languageConfig = make(map[string]*language)
+	var overlayConfig = make(map[string]*overlay)
+	var readingConfig = make(map[int]*reading)
 	var cameraConfig = make(map[string]*camera)
 
 	conf := config{
@@ -422,6 +600,16 @@ func newConfig(filename string, vmixState state) config {
 		response:  respConfig,
 		initial:   initialConfig,
 		mics:      micsConfig,
+		micScene:  micSceneConfig,
+		ducking:   duckingConfig,
+		toggle:    toggleConfig,
+		macro:     macroConfig,
+		schedule:  scheduleConfig,
+		layout:    layoutConfig,
+		language:  languageConfig,
+		overlay:   overlayConfig,
+		reading:   readingConfig,
+		misc:      miscConfig,
 	}
 
 	wb, err := excelize.OpenFile(filename)
@@ -430,6 +618,14 @@ func newConfig(filename string, vmixState state) config {
 		return conf
 	}
 
+	// General settings, one Name | Value pair per row
+	settingRows, _ := wb.GetRows("Settings")
+	for idx, row := range settingRows {
+		if idx != 0 && len(row) > 1 && row[0] != "" {
+			conf.misc[row[0]] = row[1]
+		}
+	}
+
 	// NDI Cameras
 	ndiRows, _ := wb.GetRows("NDI Cameras")
 
@@ -464,31 +660,49 @@ func newConfig(filename string, vmixState state) config {
 			btn, _ := strconv.Atoi(row[0])
 			cfg := new(shortcut)
 			cfg.button = btn
-			cfg.actionsPressed = strings.Split(row[1], "\n")
+			cfg.actionsPressed, err = parseScript(row[1])
+			if err != nil {
+				cfg.err = fmt.Errorf("pressed %v", err)
+			}
 			if len(row) > 2 {
-				cfg.actionsReleased = strings.Split(row[2], "\n")
+				cfg.actionsReleased, err = parseScript(row[2])
+				if err != nil && cfg.err == nil {
+					cfg.err = fmt.Errorf("released %v", err)
+				}
+			}
+			if cfg.err != nil {
+				fmt.Println("Error in Shortcuts, button", strconv.Itoa(btn)+":", cfg.err)
+			}
+			// Column D holds notes for the operator. Column E marks shortcuts that need a second
+			// press to confirm, ex: StopStreaming
+			if len(row) > 4 {
+				cfg.confirm = confirmTimeout(row[4])
 			}
 			conf.shortcut[btn] = cfg
 		}
 	}
 
+	// How much text fits in the titles used for verses
+	loadTitleLayouts(wb, conf, vmixState)
+
+	// Where the second language of bilingual verses is shown
+	loadLanguages(wb, conf, vmixState)
+
 	// Responses
 	respRows, _ := wb.GetRows("Responses")
 	for i, row := range respRows {
 		if i != 0 && len(row) > 1 {
 			btn, _ := strconv.Atoi(row[0])
-			var input string
-			// If input is provided as a number translate it to a name
-			if inputName, ok := vmixState.numberToName[row[1]]; ok {
-				input = inputName
-			} else {
-				input = row[1]
-			}
+			input := resolveInput(vmixState, row[1])
 
 			or := new(response)
 			or.button = btn
 			or.input = input
-			or.response = row[2]
+			or.response, or.second = splitLanguages(row[2])
+			if _, ok := conf.language[strings.ToLower(input)]; or.second != "" && !ok {
+				fmt.Println("Error in Responses, button", strconv.Itoa(btn)+":", input,
+					"has no row in the Second Language sheet")
+			}
 			or.tbName = vmixState.overlayTBNames[input]
 			conf.response[btn] = or
 		}
@@ -498,14 +712,7 @@ func newConfig(filename string, vmixState state) config {
 	prayerCols, _ := wb.GetCols("Prayers")
 	for _, col := range prayerCols {
 		var pr = new(prayer)
-		var input string
-
-		// If input is provided as a number translate it to a name
-		if inputName, ok := vmixState.numberToName[col[1]]; ok {
-			input = inputName
-		} else {
-			input = col[1]
-		}
+		input := resolveInput(vmixState, col[1])
 
 		btn, _ := strconv.Atoi(col[2])
 		pr.input = input
@@ -514,7 +721,10 @@ func newConfig(filename string, vmixState state) config {
 
 		//verses start at col[3].  Get a sub slice
 		verses := col[3:]
-		pr.verses = verses
+		pr.verses, pr.second, err = bilingualPages(conf, input, verses)
+		if err != nil {
+			fmt.Println("Error in Prayers,", col[0]+":", err)
+		}
 		conf.prayer[btn] = pr
 	}
 
@@ -524,39 +734,30 @@ func newConfig(filename string, vmixState state) config {
 	popsCols, _ := wb.GetCols("PoP")
 	for _, col := range popsCols {
 		var response = new(pop)
-		var input string
-
-		// If input is provided as a number translate it to a name
-		if inputName, ok := vmixState.numberToName[col[1]]; ok {
-			input = inputName
-		} else {
-			input = col[1]
-		}
+		input := resolveInput(vmixState, col[1])
 
 		btn, _ := strconv.Atoi(col[2])
 		response.input = input
 		response.button = btn
 		response.tbName = vmixState.overlayTBNames[input]
-		response.initialized = false
 
 		//responses start at col[3].  Get a sub slice
 		verses := col[3:]
-		response.verses = verses
+		response.verses, response.second, err = bilingualPages(conf, input, verses)
+		if err != nil {
+			fmt.Println("Error in PoP,", col[0]+":", err)
+		}
 		conf.pop[btn] = response
 	}
 
 	// Hymns
+	songs := loadSongs(conf.misc["Lyrics Folder"])
+	titlePage := strings.ToLower(conf.misc["Hymn Title Page"])
+	hymnTitlePage := titlePage == "yes" || titlePage == "y" || titlePage == "on"
 	hymnCols, _ := wb.GetCols("Hymns")
 	for _, col := range hymnCols {
 		var hy = new(hymn)
-		var input string
-
-		// If input is provided as a number translate it to a name
-		if inputName, ok := vmixState.numberToName[col[1]]; ok {
-			input = inputName
-		} else {
-			input = col[1]
-		}
+		input := resolveInput(vmixState, col[1])
 		btn, _ := strconv.Atoi(col[2])
 		hy.input = input
 		hy.button = btn
@@ -564,72 +765,74 @@ func newConfig(filename string, vmixState state) config {
 
 		//verses start at col[3].  Get a sub slice
 		verses := col[3:]
-		hy.verses = verses
+
+		// A hymn given as "Hymn 390" or "Hymn Amazing Grace" comes from the lyrics folder
+		verses, err = importHymn(songs, verses, hymnTitlePage)
+		if err != nil {
+			fmt.Println("Error in Hymns,", col[0]+":", err)
+		}
+		hy.verses, hy.second, err = bilingualPages(conf, input, verses)
+		if err != nil {
+			fmt.Println("Error in Hymns,", col[0]+":", err)
+		}
 		conf.hymn[btn] = hy
 	}
 
-	// Speakers
-	spkRows, _ := wb.GetRows("Speakers")
-	var input string
-	for idx, row := range spkRows {
-		if idx > 0 && len(row) > 0 {
-			btn, _ := strconv.Atoi(row[1])
-			// If input is provided as a number translate it to a name
-			if inputName, ok := vmixState.numberToName[row[2]]; ok {
-				input = inputName
-			} else {
-				input = row[2]
-			}
+	// Scripture readings
+	scripture := loadBible(conf.misc["Bible File"])
+	lectionary := loadLectionary(conf.misc["Lectionary File"], conf.misc["Lectionary Date"])
+	loadReadings(wb, conf, vmixState, scripture, lectionary)
 
-			script := row[3]
-			name := row[4]
+	// Speakers
+	loadSpeakers(wb, conf, vmixState)
 
-			sp := speaker{
-				button: btn,
-				input:  input,
-				script: script,
-				name:   name,
-				tbName: vmixState.overlayTBNames[input],
-			}
-
-			conf.speaker[btn] = &sp
-		}
-	}
+	// Overlay channels, transitions and textboxes of the titles
+	loadOverlays(wb, conf, vmixState)
+	applyOverlays(conf, vmixState)
 
 	//Activators
-	// map[trigger][input][vmixActivatorConfig]
+	// map[trigger][]activator, in the order of the sheet
 	activatorCols, _ := wb.GetCols("Activators")
 
 	for i, col := range activatorCols {
 		if i > 0 && len(col) > 0 {
-			var onActions []string
-			var offActions []string
+			var onActions *script
+			var offActions *script
 			var trigger string
 			var input string
 
-			//read the column in chunks of 3 lines, create a vmixActivatorConsole with the info, and
-			//add to the inputMap for that trigger
+			//read the column in chunks of 3 lines, create an activator with the info, and
+			//add it to the list for that trigger
 			trigger = col[0]
-			inputs := make(map[string]activator)
-			for i := 1; col[i] != ""; i = i + 3 {
+			for i := 1; i+1 < len(col) && col[i] != ""; i = i + 3 {
 				input = col[i]
 
-				// If the input is provided in the spreadsheet as a name we will need to get it's
-				// input number, since the Activator Subscription in the API only returns numbers
-				if inputNum, ok := vmixState.nameToNumber[input]; ok {
-					input = inputNum
-
+				// Input names are resolved when the activator runs, since inputs can be
+				// renumbered in vMix while we are running
+				rule, err := parseInputRule(input)
+				if err != nil {
+					fmt.Println("Error in Activators,", trigger, "input", input+":", err)
+					continue
+				}
+				onActions, err = parseScript(col[i+1])
+				if err != nil {
+					fmt.Println("Error in Activators,", trigger, "input", input, "Action On", err)
+				}
+				offActions = nil
+				if i+2 < len(col) {
+					offActions, err = parseScript(col[i+2])
+					if err != nil {
+						fmt.Println("Error in Activators,", trigger, "input", input, "Action Off", err)
+					}
 				}
-				onActions = strings.Split(col[i+1], "\n")
-				offActions = strings.Split(col[i+2], "\n")
 				vmc := new(activator)
 				vmc.trigger = trigger
 				vmc.input = input
+				vmc.rule = rule
 				vmc.onAction = onActions
 				vmc.offAction = offActions
-				inputs[input] = *vmc
+				conf.activator[trigger] = append(conf.activator[trigger], vmc)
 			}
-			conf.activator[trigger] = &inputs
 		}
 	}
 
@@ -658,6 +861,31 @@ func newConfig(filename string, vmixState state) config {
 		}
 	}
 
+	// Microphone scenes
+	loadMicScenes(micCols, conf)
+
+	// Audio ducking
+	loadDucking(wb, conf, vmixState)
+
+	// Toggle buttons
+	loadToggles(wb, conf, vmixState)
+
+	// Scheduled actions
+	loadSchedule(wb, conf)
+
+	// Countdown
+	loadCountdown(conf)
+
+	// Stage mode
+	loadStaging(conf)
+
+	// Run of show
+	conf.cues = loadCues(wb, conf)
+
+	// Macros are checked last, once every script that may call them is loaded
+	loadMacros(wb, conf)
+	checkMacros(conf)
+
 	return conf
 }
 
@@ -884,17 +1112,18 @@ func getMessage(client *vmixClient) {
 // processVmixMessage listens to the vMix API channel for any messages from the API.
 // It uses these messages to update the vMix State maps which are used for the
 // conditional actions. This is a blocking function.
-func processVmixMessage(client *vmixClient, midiOutChan chan apcLEDS, vmixState state, conf config) {
+func processVmixMessage(client *vmixClient, midiOutChan chan apcLEDS, verseChan chan verses, vmixState *state,
+	conf config) {
 
 	for {
 		vmixMessage := <-client.messageChan
 		messageSlice := strings.Fields(vmixMessage)
 		var input int
 		var state int
+		var value float64
 
-		if messageSlice[0] == "ACTS" && messageSlice[1] == "OK" {
+		if len(messageSlice) > 3 && messageSlice[0] == "ACTS" && messageSlice[1] == "OK" {
 			debug("Processing message:", vmixMessage)
-			processActivator(vmixMessage, midiOutChan, conf)
 			parameter := messageSlice[2]
 
 			if len(messageSlice) == 4 {
@@ -904,13 +1133,19 @@ func processVmixMessage(client *vmixClient, midiOutChan chan apcLEDS, vmixState
 			if len(messageSlice) == 5 {
 				input, _ = strconv.Atoi(messageSlice[3])
 				state, _ = strconv.Atoi(messageSlice[4])
+				value, _ = strconv.ParseFloat(messageSlice[4], 64)
 			}
 
+			vmixState.lock.Lock()
 			switch parameter {
 			case "Input":
-				vmixState.Input = input
+				if state == 1 {
+					vmixState.Input = input
+				}
 			case "InputPreview":
-				vmixState.InputPreview = input
+				if state == 1 {
+					vmixState.InputPreview = input
+				}
 			case "Overlay1":
 				if state == 1 {
 					vmixState.Overlay1 = input
@@ -952,38 +1187,38 @@ func processVmixMessage(client *vmixClient, midiOutChan chan apcLEDS, vmixState
 			case "Recording":
 				vmixState.Recording = state
 			case "InputPlaying":
-				switch state {
-				case 0:
-					vmixState.InputPlaying = map[int]bool{input: false}
-				case 1:
-					vmixState.InputPlaying = map[int]bool{input: true}
-				}
-			case "InputBusAAudio":
-				switch state {
-				case 0:
-					vmixState.InputBusAAudio = map[int]bool{input: false}
-				case 1:
-					vmixState.InputBusAAudio = map[int]bool{input: true}
-				}
-			case "InputBusBAudio":
-				switch state {
-				case 0:
-					vmixState.InputBusBAudio = map[int]bool{input: false}
-				case 1:
-					vmixState.InputBusBAudio = map[int]bool{input: true}
-				}
+				vmixState.InputPlaying[input] = state == 1
+			case "InputMasterAudio":
+				vmixState.InputMasterAudio[input] = state == 1
+			case "InputBusAAudio", "InputBusBAudio", "InputBusCAudio", "InputBusDAudio",
+				"InputBusEAudio", "InputBusFAudio", "InputBusGAudio":
+				// ex: InputBusCAudio -> C
+				bus := strings.TrimSuffix(strings.TrimPrefix(parameter, "InputBus"), "Audio")
+				busAudio(vmixState, bus)[input] = state == 1
+			case "InputAudio":
+				vmixState.InputAudio[input] = state == 1
+			case "InputVolume":
+				// The activator feed reports volumes as 0-1, the XML and SetVolume use 0-100
+				vmixState.InputVolume[input] = value * 100
 			}
+			vmixState.lock.Unlock()
+
+			// Activators run after the state is updated so that their conditions see the change
+			processActivator(vmixMessage, client, midiOutChan, verseChan, conf, vmixState)
+			publish(vmixState)
 		}
 	}
 }
 
-func processActivator(vmixMessage string, midiOutChan chan apcLEDS, conf config) {
+// processActivator runs the Action On or Action Off script of the activator matching a vMix
+// activator message. The scripts can set LEDs and send vMix functions, presets, scenes or macros.
+func processActivator(vmixMessage string, client *vmixClient, midiOutChan chan apcLEDS, verseChan chan verses,
+	conf config, vmixState *state) {
 
 	messageSlice := strings.Fields(vmixMessage)
 	trigger := messageSlice[2]
 	var state string
 	var input string
-	var actions []string
 
 	if len(messageSlice) == 5 {
 		state = messageSlice[4]
@@ -995,49 +1230,37 @@ func processActivator(vmixMessage string, midiOutChan chan apcLEDS, conf config)
 		input = "none"
 	}
 
-	if _, ok := conf.activator[trigger]; ok { //do we have an activator config for this trigger?
-		debug("Processing activator for input", input)
-		v := *conf.activator[trigger]
-		if _, ok := v[input]; ok { //do we have an activator config for this trigger and input?
-			if state == "0" {
-				actions = v[input].offAction
-				for _, action := range actions {
-					act := strings.Split(action, ": ")
-					color := act[0]
-					buttons := strings.Split(act[1], ",")
-
-					iButtons := make([]int, len(buttons))
-					for i, s := range buttons {
-						iButtons[i], _ = strconv.Atoi(s)
-					}
-					leds := apcLEDS{
-						buttons: iButtons,
-						color:   color,
-					}
-					midiOutChan <- leds
-				}
-			}
+	for _, act := range matchActivators(conf, vmixState, trigger, input) {
+		debug("Processing activator", act.input, "for input", input)
+		env := newActionEnv(client, conf, vmixState, midiOutChan, verseChan, 0)
+		// Without a vMix connection (at startup) only the LEDs are set
+		env.ledsOnly = client == nil
+		// The input that triggered the activator, for rules that match several inputs
+		env.args["input"] = input
+		env.args["name"] = inputName(vmixState, input)
+		var s *script
+		switch state {
+		case "0":
+			s = act.offAction
+		case "1":
+			s = act.onAction
 		}
-
-		if state == "1" {
-			actions = v[input].onAction
-			for _, action := range actions {
-				act := strings.Split(action, ": ")
-				color := act[0]
-				buttons := strings.Split(act[1], ",")
-				iButtons := make([]int, len(buttons))
-				for i, s := range buttons {
-					iButtons[i], _ = strconv.Atoi(s)
-
-				}
-
-				leds := apcLEDS{
-					buttons: iButtons,
-					color:   color,
-				}
-				midiOutChan <- leds
-			}
+		if s == nil {
+			continue
 		}
+		if env.ledsOnly || !s.async {
+			execBlock(s.stmts, env)
+			continue
+		}
+		// Scripts that wait run off the feed so that they don't hold up the vMix messages
+		if !startActivator(act, input, state) {
+			debug("Activator", act.input, "is already running, ignoring", vmixMessage)
+			continue
+		}
+		go func(act *activator, input, state string, s *script, env *actionEnv) {
+			defer finishActivator(act, input, state)
+			execBlock(s.stmts, env)
+		}(act, input, state, s, env)
 	}
 }
 
@@ -1112,7 +1335,7 @@ func sendMidi(midiInChan chan []byte) {
 }
 
 func processMidi(midiInChan chan []byte, midiOutChan chan apcLEDS, verseChan chan verses, client *vmixClient,
-	conf config) {
+	conf config, vmixState *state) {
 	// message is a byte [type button velocity]
 	// type 144, velocity 0 is a button up
 	// type 144, velocity 127 is a button down
@@ -1129,156 +1352,114 @@ func processMidi(midiInChan chan []byte, midiOutChan chan apcLEDS, verseChan cha
 				// button pressed
 				debug("Button Down:", msg[1], button)
 
+				if !confirmPress(button, conf, midiOutChan) {
+					break
+				}
+
+				if button == panicButton(conf) {
+					panicPress(client, conf, vmixState, midiOutChan)
+					break
+				}
+
+				if scheduleCancelButton(conf, button) {
+					break
+				}
+
+				if countdownButton(conf, button) {
+					break
+				}
+
+				if verseProgressButton(conf, verseChan, button) {
+					break
+				}
+
+				if cueButton(newActionEnv(client, conf, vmixState, midiOutChan, verseChan, button), button) {
+					break
+				}
+
+				if button == takeButton(conf) {
+					takeStaged(client, conf, midiOutChan)
+					break
+				}
+
 				if _, ok := conf.response[button]; ok {
-					execTextOverlay(client, button, conf)
+					execTextOverlay(client, button, conf, midiOutChan)
 					midiOutChan <- apcLEDS{
 						buttons: []int{button},
 						color:   "red",
 					}
 				}
 
-				if item, ok := conf.prayer[button]; ok {
-					tbName := conf.prayer[button].tbName
-					*currentVerses = verses{item.input, tbName, item.verses, 0}
-					verseChan <- *currentVerses
+				if _, ok := conf.prayer[button]; ok {
+					startVerses(conf, button, verseChan)
 					//Turn on crowd mic
 					//message = append(message, "FUNCTION AudioOn Input="+conf.mics["Crowd"])
 					message = append(message, "FUNCTION AudioBusOn Value=M&Input="+conf.mics["Crowd"])
 				}
 
-				if item, ok := conf.pop[button]; ok {
-
-					if conf.pop[button].initialized == false {
-						tbName := conf.pop[button].tbName
-						*currentVerses = verses{item.input, tbName, item.verses, 0}
-						verseChan <- *currentVerses
-						conf.pop[button].initialized = true
+				if _, ok := conf.pop[button]; ok {
+					// Each press shows the next response
+					if startVerses(conf, button, verseChan) {
+						midiOutChan <- apcLEDS{
+							buttons: []int{button},
+							color:   "red",
+						}
 					} else {
-						if currentVerses.input != "" {
-							currentVerses.verseIndex++
-							if currentVerses.verseIndex < len(currentVerses.verses) {
-								verseChan <- *currentVerses
-								midiOutChan <- apcLEDS{
-									buttons: []int{button},
-									color:   "red",
-								}
-							} else {
-								//we got to the end. Turn off the button led
-								midiOutChan <- apcLEDS{
-									buttons: []int{button},
-									color:   "off",
-								}
-							}
-
+						//we got to the end. Turn off the button led
+						midiOutChan <- apcLEDS{
+							buttons: []int{button},
+							color:   "off",
 						}
 					}
 					//Turn on crowd mic
 					message = append(message, "FUNCTION AudioBusOn Value=M&Input="+conf.mics["Crowd"])
 				}
 
-				if item, ok := conf.hymn[button]; ok {
-					tbName := conf.hymn[button].tbName
-					*currentVerses = verses{item.input, tbName, item.verses, 0}
-					verseChan <- *currentVerses
+				if _, ok := conf.hymn[button]; ok {
+					startVerses(conf, button, verseChan)
+				}
+
+				if _, ok := conf.reading[button]; ok {
+					startVerses(conf, button, verseChan)
 				}
 
 				if speaker, ok := conf.speaker[button]; ok {
-					var m string
-
-					name := speaker.name
-					script := speaker.script
-					input := speaker.input
-					textBox := speaker.tbName
-
-					if len(script) > 1 {
-						m = "FUNCTION ScriptStart Value=" +
-							url.QueryEscape(script)
-						_ = SendMessage(client, m)
-						//Give the script some time to complete
-						time.Sleep(time.Millisecond * 500)
-					}
+					showSpeaker(client, conf, midiOutChan, vmixState, speaker)
+				}
 
-					m = "FUNCTION SetText Input=" + input + "&SelectedName=" +
-						url.QueryEscape(textBox) +
-						"&Value=" + url.QueryEscape(name)
-					message = append(message, m)
-					time.Sleep(time.Millisecond * 1200)
-					m = "FUNCTION OverlayInput1In Input=" + input
-					message = append(message, m)
+				if t, ok := conf.toggle[button]; ok {
+					flipToggle(client, t, vmixState)
+				}
 
+				if scene := micSceneForButton(conf, button); scene != nil {
+					recallMicScene(client, scene, conf, midiOutChan)
 				}
 
-				if _, ok := conf.shortcut[button]; ok {
-
-					for _, action := range conf.shortcut[button].actionsPressed {
-						debug("Performing action:", action)
-						if strings.HasPrefix(action, "leds") {
-							// ex: leds green 1,2,3
-							parts := strings.Split(action, " ")
-							color := parts[1]
-							leds := strings.Split(parts[2], ",")
-							iLeds := make([]int, len(leds))
-							for i, s := range leds {
-								iLeds[i], _ = strconv.Atoi(s)
-							}
-							midiOutChan <- apcLEDS{
-								buttons: iLeds,
-								color:   color,
-							}
-
-						} else if strings.HasPrefix(action, "preset") {
-
-							// Move PTZ camera to preset position
-							// syntax: preset camera_name preset_number
-							parts := strings.Split(action, " ")
-							camera := strings.ToLower(parts[1])
-							preset := parts[2]
-							debug("Starting move camera '" + camera + "' to preset: " + preset)
-
-							if cameraConfig, ok := conf.camera[camera]; ok {
-								cameraPreset(cameraConfig, preset)
-							}
-
-						} else if action == "Next" {
-							if currentVerses.input != "" {
-								currentVerses.verseIndex++
-								if currentVerses.verseIndex < len(currentVerses.verses) {
-									verseChan <- *currentVerses
-								}
-								midiOutChan <- apcLEDS{
-									buttons: []int{button},
-									color:   "yellow",
-								}
-							}
-						} else if action == "Prev" {
-							if currentVerses.input != "" {
-								currentVerses.verseIndex--
-								if currentVerses.verseIndex >= 0 {
-									verseChan <- *currentVerses
-								}
-							}
-						} else if action == "OvOff" {
-							m := "FUNCTION OverlayInput1Out Input=" + currentVerses.input
-							*currentVerses = verses{"", "", []string{}, 0}
-
-							message = append(message, m)
-							// Run OverlayOff script
-							message = append(message, "FUNCTION ScriptStart Value=OverlayOff")
-
-						} else {
-							m := "FUNCTION " + action
-							message = append(message, m)
-						}
+				if sc, ok := conf.shortcut[button]; ok {
+					if brokenShortcut(sc, midiOutChan) {
+						break
 					}
+					env := newActionEnv(client, conf, vmixState, midiOutChan, verseChan, button)
+					runScript(sc.actionsPressed, env)
 				}
 			}
 			if msg[2] == 0 {
 				//button released
 				debug("Button Up:", msg[1], button)
 
+				if !confirmRelease(button) || !progressRelease(button) {
+					break
+				}
+
+				if button == panicButton(conf) {
+					panicRelease(client, conf, vmixState, midiOutChan)
+					break
+				}
+
 				//PoP remove response overlay
-				if _, ok := conf.pop[button]; ok {
-					message = append(message, "FUNCTION OverlayInput1Out")
+				if item, ok := conf.pop[button]; ok {
+					message = append(message, item.overlay.hideFunction())
+					hideSecondTitle(client, conf, item.input)
 					//Turn off crowd mic
 					//message = append(message, "FUNCTION AudioOff Input="+conf.mics["Crowd"])
 					message = append(message, "FUNCTION AudioBusOff Value=M&Input="+conf.mics["Crowd"])
@@ -1287,8 +1468,9 @@ func processMidi(midiInChan chan []byte, midiOutChan chan apcLEDS, verseChan cha
 				//Check respConfig to see if we have a match. If so remove the overlay and turn
 				//off the crowd mic
 
-				if _, ok := conf.response[button]; ok {
-					message = append(message, "FUNCTION OverlayInput1Out")
+				if item, ok := conf.response[button]; ok {
+					message = append(message, item.overlay.hideFunction())
+					hideSecondTitle(client, conf, item.input)
 					//message = append(message, "FUNCTION AudioOff Input="+conf.mics["Crowd"])
 					message = append(message, "FUNCTION AudioBusOff Value=M&Input="+conf.mics["Crowd"])
 
@@ -1305,32 +1487,9 @@ func processMidi(midiInChan chan []byte, midiOutChan chan apcLEDS, verseChan cha
 					}
 				}
 
-				if _, ok := conf.shortcut[button]; ok {
-					for _, action := range conf.shortcut[button].actionsReleased {
-						if action != "" {
-							debug("Shortcut action to be taken:", action)
-							if action != "" {
-								if strings.HasPrefix(action, "leds") {
-									// ex: leds green 1,2,3
-									parts := strings.Split(action, " ")
-									color := parts[1]
-									leds := strings.Split(parts[2], ",")
-									iLeds := make([]int, len(leds))
-									for i, s := range leds {
-										iLeds[i], _ = strconv.Atoi(s)
-									}
-									midiOutChan <- apcLEDS{
-										buttons: iLeds,
-										color:   color,
-									}
-
-								} else {
-									m := "FUNCTION " + action + "\r\n"
-									message = append(message, m)
-								}
-							}
-						}
-					}
+				if sc, ok := conf.shortcut[button]; ok && sc.err == nil {
+					env := newActionEnv(client, conf, vmixState, midiOutChan, verseChan, button)
+					runScript(sc.actionsReleased, env)
 				}
 			}
 
@@ -1381,6 +1540,11 @@ func processMidi(midiInChan chan []byte, midiOutChan chan apcLEDS, verseChan cha
 
 func cameraPreset(cameraConfig *camera, preset string) {
 
+	// Remember the preset so that it can be captured in a snapshot
+	cameraConfig.lock.Lock()
+	cameraConfig.preset = preset
+	cameraConfig.lock.Unlock()
+
 	if strings.ToLower(cameraConfig.mode) == "null" {
 		debug("Null camera: not doing anything")
 		return
@@ -1448,16 +1612,17 @@ func cameraPreset(cameraConfig *camera, preset string) {
 
 }
 
-func execTextOverlay(client *vmixClient, button int, conf config) {
+func execTextOverlay(client *vmixClient, button int, conf config, midiOutChan chan apcLEDS) {
 	var message string
 
 	if item, ok := conf.response[button]; ok {
 
-		//set the text
-		message = "FUNCTION SetText Input=" + url.QueryEscape(item.input) + "&SelectedName=" +
-			url.QueryEscape(item.tbName) +
-			"&Value=" + url.QueryEscape(item.response)
-		_ = SendMessage(client, message)
+		//set the text, with its second language when there is one
+		texts := make(map[string]string)
+		item.overlay.setText(texts, item.tbName, item.response)
+		translation := addSecondLanguage(conf, item.input, texts, item.second)
+		setTexts(client, item.input, texts)
+		showSecondTitle(client, conf, item.input, translation)
 
 		// Turn on the crowd mic
 		//message = "FUNCTION AudioOn Input=" + conf.mics["Crowd"]
@@ -1467,28 +1632,44 @@ func execTextOverlay(client *vmixClient, button int, conf config) {
 		//pause for 100 milliseconds to allow text to update in the title
 		d, _ := time.ParseDuration("100ms")
 		time.Sleep(d)
-		message = "FUNCTION OverlayInput1In Input=" + item.input
-		_ = SendMessage(client, message)
+		overlayShown(item.overlay, conf, midiOutChan)
+		_ = SendMessage(client, item.overlay.showFunction(item.input))
 	}
 }
 
-func versePager(verseChan chan verses, client *vmixClient) {
-	var message string
+func versePager(verseChan chan verses, client *vmixClient, conf config, midiOutChan chan apcLEDS) {
 	for {
 
 		item := <-verseChan
 		debug("versePager received item:", item)
 
-		message = "FUNCTION SetText Input=" + url.QueryEscape(item.input) + "&SelectedName=TextBlock1.Text&Value=" +
-			url.QueryEscape(item.verses[currentVerses.verseIndex])
-		err := SendMessage(client, message)
-		if err != nil {
-			fmt.Print("***Error sending message: ", err)
+		texts := make(map[string]string)
+		item.overlay.setText(texts, item.tbName, item.verses[item.verseIndex])
+		if item.refTbName != "" && item.verseIndex < len(item.refs) {
+			texts[item.refTbName] = item.refs[item.verseIndex]
+		}
+
+		// The second language goes in another textbox of the title or in a second title
+		var translation string
+		if item.verseIndex < len(item.second) {
+			translation = item.second[item.verseIndex]
+		}
+		translation = addSecondLanguage(conf, item.input, texts, translation)
+		showVerseProgress(conf, midiOutChan, item.verseIndex, len(item.verses))
+
+		// In stage mode the verse waits on Preview for the Take button
+		if stageText(client, conf, midiOutChan, stagedText{input: item.input, texts: texts, second: translation,
+			overlay: item.overlay}) {
+			continue
 		}
+
+		setTexts(client, item.input, texts)
+		showSecondTitle(client, conf, item.input, translation)
+
 		// Wait a bit to ensure title text is changed
 		time.Sleep(time.Millisecond * 300)
-		message = "FUNCTION OverlayInput1In Input=" + item.input
-		_ = SendMessage(client, message)
+		overlayShown(item.overlay, conf, midiOutChan)
+		_ = SendMessage(client, item.overlay.showFunction(item.input))
 	}
 }
 
@@ -1598,16 +1779,6 @@ func initMidi(midiInChan chan []byte, midiOutChan chan apcLEDS) {
 func setAPCLED(led apcLEDS, outPort *midi.Out) {
 
 	debug("Received apcLED", led)
-	values := map[string]uint8{
-		"green":       1,
-		"greenBlink":  2,
-		"red":         3,
-		"redBlink":    4,
-		"yellow":      5,
-		"yellowBlink": 6,
-		"on":          1, // for round buttons - they can only be red/green (on)
-		"blink":       2, // or red/green blinking (blink)
-	}
 	wr := writer.New(*outPort)
 	wr.ConsolidateNotes(false)
 
@@ -1616,7 +1787,7 @@ func setAPCLED(led apcLEDS, outPort *midi.Out) {
 		if led.color == "off" {
 			_ = writer.NoteOff(wr, uint8(b))
 		} else {
-			_ = writer.NoteOn(wr, uint8(b), values[led.color])
+			_ = writer.NoteOn(wr, uint8(b), ledValues[led.color])
 		}
 	}
 }
@@ -1674,6 +1845,8 @@ func main() {
 	apiAddress := flag.String("apiAddr", "127.0.0.1:8099", "IP address and port of vMix API (127.0.0.1:8099)")
 	fileName := flag.String("fileName", "D:/OneDrive/Episcopal Church of Reconciliation/Livestream - Documents/Livestream.xlsm",
 		"Path and filename to the vmixAPC configuration workbook")
+	httpAddress := flag.String("httpAddr", "127.0.0.1:8090", "IP address and port for the vmixAPC HTTP API")
+	snapshotFile := flag.String("snapshotFile", "snapshots.json", "Path and filename where named snapshots are saved")
 	flag.Parse()
 	debug("Starting vMixAPC ...")
 
@@ -1693,6 +1866,7 @@ func main() {
 
 	vmixState := updateVmixState(vcConf)
 	vmConfig := newConfig(*fileName, vmixState)
+	loadSnapshots(*snapshotFile)
 
 	setAllLed("off", midiOutChan)
 
@@ -1701,13 +1875,20 @@ func main() {
 	//	go watchConfigFile(&vmConfig, *fileName, vmixState)
 
 	go getMessage(vmClient)
-	go processVmixMessage(vmClient, midiOutChan, vmixState, vmConfig)
+	go processVmixMessage(vmClient, midiOutChan, verseChan, vmixState, vmConfig)
+	go runDucking(vcConf, vmClient, vmixState, vmConfig)
+	go refreshInputs(vcConf, vmConfig, vmixState)
+	go serveAPI(*httpAddress, vmClient, vmConfig, vmixState, midiOutChan, verseChan)
 
 	go initMidi(midiInChan, midiOutChan)
-	go processMidi(midiInChan, midiOutChan, verseChan, vmClient, vmConfig)
-	go versePager(verseChan, vmClient)
+	go processMidi(midiInChan, midiOutChan, verseChan, vmClient, vmConfig, vmixState)
+	go versePager(verseChan, vmClient, vmConfig, midiOutChan)
 
 	setInitialState(vmConfig, midiOutChan, vmixState)
+	showCues(vmConfig, midiOutChan)
+	go runToggles(vmConfig, vmixState, midiOutChan)
+	go runSchedule(vmClient, vmConfig, vmixState, midiOutChan, verseChan)
+	go runCountdown(vmClient, vmConfig, vmixState, midiOutChan, verseChan)
 
 	go sendMidi(midiInChan)
 